@@ -0,0 +1,203 @@
+package hitomi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// BatchOptions are options for Client.Galleries.
+type BatchOptions struct {
+	// Concurrency is the maximum number of galleries fetched at once.
+	Concurrency int
+
+	// Ordered is an option to emit results in the order of ids.
+	// Otherwise, results are emitted as soon as they are fetched.
+	Ordered bool
+
+	// Cache is used to reuse galleries fetched before, if it is set.
+	Cache GalleryCache
+
+	// Filter excludes galleries, if it is set.
+	// Results of excluded galleries have Err wrapping the *Exclusion, which is ErrExcluded.
+	Filter *Filter
+}
+
+func (o *BatchOptions) WithConcurrency(n int) *BatchOptions {
+	o.Concurrency = n
+	return o
+}
+
+func (o *BatchOptions) WithOrdered(b bool) *BatchOptions {
+	o.Ordered = b
+	return o
+}
+
+func (o *BatchOptions) WithCache(c GalleryCache) *BatchOptions {
+	o.Cache = c
+	return o
+}
+
+func (o *BatchOptions) WithFilter(f *Filter) *BatchOptions {
+	o.Filter = f
+	return o
+}
+
+func DefaultBatchOptions() *BatchOptions {
+	return &BatchOptions{
+		Concurrency: 8,
+		Ordered:     false,
+		Cache:       nil,
+		Filter:      nil,
+	}
+}
+
+// GalleryCache stores fetched galleries.
+// Implementations must be safe for concurrent use.
+type GalleryCache interface {
+	Get(id int) (*Gallery, bool)
+	Set(id int, gallery *Gallery)
+}
+
+// MemoryGalleryCache is a GalleryCache which keeps galleries in memory.
+type MemoryGalleryCache struct {
+	mu        sync.RWMutex
+	galleries map[int]*Gallery
+}
+
+func NewMemoryGalleryCache() *MemoryGalleryCache {
+	return &MemoryGalleryCache{
+		galleries: map[int]*Gallery{},
+	}
+}
+
+func (m *MemoryGalleryCache) Get(id int) (*Gallery, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	gallery, ok := m.galleries[id]
+	return gallery, ok
+}
+
+func (m *MemoryGalleryCache) Set(id int, gallery *Gallery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.galleries[id] = gallery
+}
+
+// GalleryResult is a result of Client.Galleries.
+// Either Gallery or Err is set.
+type GalleryResult struct {
+	Id      int
+	Gallery *Gallery
+	Err     error
+}
+
+// Galleries fetches galleries of ids concurrently.
+// The returned channel is closed after all galleries are fetched or ctx is done and every request has stopped,
+// so the caller must either drain it or cancel ctx.
+func (c *Client) Galleries(ctx context.Context, ids []int, opts *BatchOptions) <-chan GalleryResult {
+	if opts == nil {
+		opts = DefaultBatchOptions()
+	}
+	concurrency := max(opts.Concurrency, 1)
+
+	type indexedResult struct {
+		index  int
+		result GalleryResult
+	}
+	jobs := make(chan int)
+	results := make(chan indexedResult)
+	out := make(chan GalleryResult)
+
+	go func() {
+		defer close(jobs)
+		for i := range ids {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				result := c.batchGallery(ctx, ids[index], opts)
+				select {
+				case results <- indexedResult{index: index, result: result}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		defer func() {
+			// wait for workers to exit, so that no request is running after out is closed
+			for range results {
+			}
+			close(out)
+		}()
+		pending := map[int]GalleryResult{}
+		next := 0
+		for r := range results {
+			if !opts.Ordered {
+				select {
+				case out <- r.result:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			pending[r.index] = r.result
+			for {
+				result, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				select {
+				case out <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (c *Client) batchGallery(ctx context.Context, id int, opts *BatchOptions) GalleryResult {
+	var gallery *Gallery
+	var ok bool
+	if opts.Cache != nil {
+		gallery, ok = opts.Cache.Get(id)
+	}
+	if !ok {
+		var err error
+		gallery, err = c.GalleryContext(ctx, strconv.Itoa(id))
+		if err != nil {
+			return GalleryResult{Id: id, Err: fmt.Errorf("gallery %d: %w", id, err)}
+		}
+		if opts.Cache != nil {
+			opts.Cache.Set(id, gallery)
+		}
+	}
+	if opts.Filter != nil {
+		if exclusion := opts.Filter.Check(gallery); exclusion != nil {
+			return GalleryResult{Id: id, Err: fmt.Errorf("gallery %d: %w", id, exclusion)}
+		}
+	}
+	return GalleryResult{Id: id, Gallery: gallery}
+}
@@ -0,0 +1,88 @@
+package hitomi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+// galleryServer serves galleries/<id>.js for any id except 404, counting requests.
+func galleryServer(requests, inflight, maxInflight *int32) *http.Client {
+	return stub.Client(func(req *http.Request) *http.Response {
+		atomic.AddInt32(requests, 1)
+		n := atomic.AddInt32(inflight, 1)
+		defer atomic.AddInt32(inflight, -1)
+		for {
+			m := atomic.LoadInt32(maxInflight)
+			if n <= m || atomic.CompareAndSwapInt32(maxInflight, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/galleries/"), ".js")
+		if id == "404" {
+			return stub.Response(404, "")
+		}
+		return stub.Response(200, fmt.Sprintf(`var galleryinfo = {"id":%s,"title":"gallery %s","type":"manga"}`, id, id))
+	})
+}
+
+func TestClient_Galleries(t *testing.T) {
+	var requests, inflight, maxInflight int32
+	c := NewClient(DefaultOptions().WithClient(galleryServer(&requests, &inflight, &maxInflight)))
+	ids := []int{1, 2, 3, 404, 5, 6, 7, 8, 9, 10}
+	cache := NewMemoryGalleryCache()
+
+	var got []int
+	var failed int
+	for result := range c.Galleries(context.Background(), ids, DefaultBatchOptions().WithConcurrency(3).WithOrdered(true).WithCache(cache)) {
+		got = append(got, result.Id)
+		if result.Err != nil {
+			failed++
+			continue
+		}
+		if result.Gallery.Id != fmt.Sprint(result.Id) {
+			t.Errorf("result %d has gallery %s", result.Id, result.Gallery.Id)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Errorf("results out of order: %v", got)
+	}
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	if n := atomic.LoadInt32(&maxInflight); n > 3 {
+		t.Errorf("max concurrent requests = %d, want <= 3", n)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	for range c.Galleries(context.Background(), ids, DefaultBatchOptions().WithCache(cache)) {
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests with cache = %d, want 1", n)
+	}
+}
+
+func TestClient_Galleries_Cancel(t *testing.T) {
+	var requests, inflight, maxInflight int32
+	c := NewClient(DefaultOptions().WithClient(galleryServer(&requests, &inflight, &maxInflight)))
+	ids := make([]int, 100)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	results := c.Galleries(ctx, ids, DefaultBatchOptions().WithConcurrency(2))
+	<-results
+	cancel()
+	for range results {
+	}
+	if n := atomic.LoadInt32(&requests); n >= 100 {
+		t.Errorf("requests after cancel = %d", n)
+	}
+}
@@ -1,12 +1,17 @@
 package hitomi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/EINNN7/hitomi/internal/script"
@@ -16,8 +21,12 @@ import (
 type Client struct {
 	options *Options
 
+	// scriptMu guards script and lastScriptUpdated, so that FileURL can be called while the script is updated.
+	scriptMu          sync.RWMutex
 	script            *script.Script
 	lastScriptUpdated time.Time
+	// updateMu keeps concurrent FileURL calls from fetching gg.js at the same time.
+	updateMu sync.Mutex
 }
 
 // NewClient creates a new hitomi client.
@@ -48,16 +57,31 @@ func (c *Client) UpdateScript() error {
 	if err != nil {
 		return err
 	}
-	c.script = script.ParseScript(string(content))
+	parsed := script.ParseScript(string(content))
+	c.scriptMu.Lock()
+	c.script = parsed
 	c.lastScriptUpdated = time.Now()
+	c.scriptMu.Unlock()
 
-	c.options.Logger.Debug().Str("base_path", c.script.BasePath).Msgf("Script updated")
+	c.options.Logger.Debug().Str("base_path", parsed.BasePath).Msgf("Script updated")
 	return nil
 }
 
+// currentScript returns script and when it was updated.
+func (c *Client) currentScript() (*script.Script, time.Time) {
+	c.scriptMu.RLock()
+	defer c.scriptMu.RUnlock()
+	return c.script, c.lastScriptUpdated
+}
+
 // Gallery returns normalized gallery information.
 func (c *Client) Gallery(id string) (*Gallery, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://ltn.hitomi.la/galleries/%s.js", id), nil)
+	return c.GalleryContext(context.Background(), id)
+}
+
+// GalleryContext is like Gallery but with context.
+func (c *Client) GalleryContext(ctx context.Context, id string) (*Gallery, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://ltn.hitomi.la/galleries/%s.js", id), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -84,29 +108,74 @@ func (c *Client) Gallery(id string) (*Gallery, error) {
 
 // File returns file bytes
 func (c *Client) File(url, galleryId string) ([]byte, error) {
-	req := c.FileRequest(url, galleryId)
+	return c.fileContent(c.FileRequest(url, galleryId))
+}
+
+func (c *Client) fileContent(req *http.Request) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if _, err := c.Download(req, buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ProgressFunc reports download progress.
+// total is -1 if the size is unknown.
+type ProgressFunc func(written, total int64)
+
+// Download streams response of req into w, calling progress after each chunk is written.
+// req is usually made by FileRequest or VideoRequest.
+func (c *Client) Download(req *http.Request, w io.Writer, progress ProgressFunc) (int64, error) {
 	resp, err := c.options.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("failed to get file: %d", resp.StatusCode)
+		return 0, fmt.Errorf("failed to get file: %d", resp.StatusCode)
 	}
-	return io.ReadAll(resp.Body)
+	if progress == nil {
+		return io.Copy(w, resp.Body)
+	}
+	return io.Copy(&progressWriter{w: w, total: resp.ContentLength, progress: progress}, resp.Body)
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
 }
 
 // FileURL returns calculated url for file
 // returned file url is not permanent, usually it lasts 30~ minutes after gg.js updated
+// It is safe to call concurrently with UpdateScript, and returns empty string if gg.js has never been fetched.
 func (c *Client) FileURL(hash string) string {
-	if c.options.UpdateScriptInterval != -1 && time.Since(c.lastScriptUpdated) > c.options.UpdateScriptInterval {
-		if err := c.UpdateScript(); err != nil {
-			c.options.Logger.Warn().Err(err).Msg("failed to update script")
+	s, updated := c.currentScript()
+	if c.options.UpdateScriptInterval != -1 && time.Since(updated) > c.options.UpdateScriptInterval {
+		c.updateMu.Lock()
+		// another call may have updated it while waiting
+		if s, updated = c.currentScript(); time.Since(updated) > c.options.UpdateScriptInterval {
+			if err := c.UpdateScript(); err != nil {
+				c.options.Logger.Warn().Err(err).Msg("failed to update script")
+			}
+			s, _ = c.currentScript()
 		}
+		c.updateMu.Unlock()
+	}
+	if s == nil {
+		return ""
 	}
-	return fmt.Sprintf("https://%s.hitomi.la/webp/%s.webp", c.script.SubdomainFromURL(fmt.Sprintf("https://a.hitomi.la/webp/%s", c.script.FullPathFromHash(hash)), "a"), c.script.FullPathFromHash(hash))
+	return fmt.Sprintf("https://%s.hitomi.la/webp/%s.webp", s.SubdomainFromURL(fmt.Sprintf("https://a.hitomi.la/webp/%s", s.FullPathFromHash(hash)), "a"), s.FullPathFromHash(hash))
 }
 
 // FileRequest returns *http.Request for file
@@ -118,6 +187,20 @@ func (c *Client) FileRequest(url, galleryId string) *http.Request {
 	return req
 }
 
+// VideoRequest returns *http.Request for video of anime gallery.
+func (c *Client) VideoRequest(gallery *Gallery) (*http.Request, error) {
+	if !gallery.HasVideo() {
+		return nil, fmt.Errorf("gallery %s has no video", gallery.Id)
+	}
+	req, err := http.NewRequest("GET", gallery.VideoURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "video/webm,video/mp4,video/*;q=0.9,*/*;q=0.8")
+	req.Header.Set("Referer", "https://hitomi.la"+gallery.GalleryUrl)
+	return req, nil
+}
+
 // Gallery represents gallery information.
 type Gallery struct {
 	Language          string
@@ -128,7 +211,8 @@ type Gallery struct {
 	LanguageLocalName string
 	Title             string
 	Date              string
-	Type              string
+	Published         time.Time
+	Type              GalleryType
 	GalleryUrl        string
 	JapaneseTitle     *string
 	Languages         []struct {
@@ -137,10 +221,7 @@ type Gallery struct {
 		Name      string
 		Url       string
 	}
-	Tags []struct {
-		Tag string
-		Url string
-	}
+	Tags    []Tag
 	Artists []struct {
 		Artist string
 		Url    string
@@ -167,11 +248,70 @@ type Gallery struct {
 		Group string
 		Url   string
 	}
+
+	// Video fields are only set for anime galleries.
+
+	// VideoFilename is the name of video file, like "12345.mp4".
+	VideoFilename string
+	// Video is the raw video field of gallery script.
+	Video string
+	// SceneIndexes are indexes of scene thumbnails of video.
+	SceneIndexes []int
+}
+
+// HasVideo reports whether the gallery has a video.
+func (g *Gallery) HasVideo() bool {
+	return g.VideoFilename != ""
+}
+
+// QueryTags returns every tag of gallery which can be searched, named as in queries,
+// including artists, groups, series, characters, language and type.
+func (g *Gallery) QueryTags() []Tag {
+	tags := slices.Clone(g.Tags)
+	add := func(namespace, name string) {
+		if name != "" {
+			tags = append(tags, Tag{Namespace: namespace, Name: strings.ToLower(name)})
+		}
+	}
+	for _, a := range g.Artists {
+		add(NamespaceArtist, a.Artist)
+	}
+	for _, group := range g.Groups {
+		add(NamespaceGroup, group.Group)
+	}
+	for _, p := range g.Parodies {
+		add(NamespaceSeries, p.Parody)
+	}
+	for _, c := range g.Characters {
+		add(NamespaceCharacter, c.Character)
+	}
+	add(NamespaceLanguage, g.Language)
+	if g.Type != GalleryTypeUnknown {
+		tags = append(tags, g.Type.Tag())
+	}
+	return tags
+}
+
+// VideoURL returns url of video stream.
+// Unlike FileURL, it does not depend on gg.js.
+func (g *Gallery) VideoURL() string {
+	if !g.HasVideo() {
+		return ""
+	}
+	return "https://streaming.hitomi.la/videos/" + g.VideoFilename
+}
+
+// VideoPosterURL returns url of video poster image.
+func (g *Gallery) VideoPosterURL() string {
+	if !g.HasVideo() {
+		return ""
+	}
+	return "https://tn.hitomi.la/videos/" + strings.TrimSuffix(g.VideoFilename, path.Ext(g.VideoFilename)) + ".jpg"
 }
 
 type galleryScript struct {
 	Related      []int         `json:"related"`
-	SceneIndexes []interface{} `json:"scene_indexes"`
+	SceneIndexes []json.Number `json:"scene_indexes"`
 	Languages    []struct {
 		LanguageLocalname string `json:"language_localname"`
 		Galleryid         string `json:"galleryid"`
@@ -184,8 +324,8 @@ type galleryScript struct {
 		Tag    string      `json:"tag"`
 		Url    string      `json:"url"`
 	} `json:"tags"`
-	Videofilename interface{} `json:"videofilename"`
-	JapaneseTitle *string     `json:"japanese_title"`
+	Videofilename *string `json:"videofilename"`
+	JapaneseTitle *string `json:"japanese_title"`
 	Artists       []struct {
 		Artist string `json:"artist"`
 		Url    string `json:"url"`
@@ -203,9 +343,9 @@ type galleryScript struct {
 		Hash    string `json:"hash"`
 		Single  int    `json:"single,omitempty"`
 	} `json:"files"`
-	Date       string      `json:"date"`
-	Video      interface{} `json:"video"`
-	Type       string      `json:"type"`
+	Date       string  `json:"date"`
+	Video      *string `json:"video"`
+	Type       string  `json:"type"`
 	Characters []struct {
 		Character string `json:"character"`
 		Url       string `json:"url"`
@@ -254,20 +394,15 @@ func (g *galleryScript) Normalize() *Gallery {
 	}
 	// Convert tags
 	for _, tag := range g.Tags {
-		var tagType string
-		if v, ok := tag.Male.(string); ok && v == "1" {
-			tagType = "male:"
-		} else if v, ok := tag.Female.(string); ok && v == "1" {
-			tagType = "female:"
-		} else {
-			tagType = "tag:"
+		namespace := NamespaceTag
+		if isFlagSet(tag.Male) {
+			namespace = NamespaceMale
+		} else if isFlagSet(tag.Female) {
+			namespace = NamespaceFemale
 		}
-		gallery.Tags = append(gallery.Tags, struct {
-			Tag string
-			Url string
-		}{
-			Tag: tagType + strings.ReplaceAll(tag.Tag, " ", "_"),
-			Url: tag.Url,
+		gallery.Tags = append(gallery.Tags, Tag{
+			Namespace: namespace,
+			Name:      tag.Tag,
 		})
 	}
 	gallery.JapaneseTitle = g.JapaneseTitle
@@ -303,7 +438,8 @@ func (g *galleryScript) Normalize() *Gallery {
 	}
 
 	gallery.Date = g.Date
-	gallery.Type = g.Type
+	gallery.Published, _ = parseDate(g.Date)
+	gallery.Type = ParseGalleryType(g.Type)
 	gallery.Characters = []struct {
 		Character string
 		Url       string
@@ -321,5 +457,30 @@ func (g *galleryScript) Normalize() *Gallery {
 	gallery.Id = g.GetId()
 	gallery.Blocked = g.Blocked == 1
 
+	// Convert video
+	if g.Videofilename != nil {
+		gallery.VideoFilename = *g.Videofilename
+	}
+	if g.Video != nil {
+		gallery.Video = *g.Video
+	}
+	for _, index := range g.SceneIndexes {
+		if v, err := index.Float64(); err == nil {
+			gallery.SceneIndexes = append(gallery.SceneIndexes, int(v))
+		}
+	}
+
 	return gallery
 }
+
+// isFlagSet reports whether a flag in gallery script is set.
+// hitomi encodes flags either as "1" or 1.
+func isFlagSet(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return v == "1"
+	case float64:
+		return v == 1
+	}
+	return false
+}
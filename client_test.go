@@ -1,11 +1,16 @@
 package hitomi
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/EINNN7/hitomi/internal/stub"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -45,3 +50,93 @@ func TestClient_File(t *testing.T) {
 	}
 	t.Log(http.DetectContentType(file))
 }
+
+// scriptClient returns client serving gallery scripts by id, and galleries of them by id.
+func scriptClient(t *testing.T, scripts map[int]string) (*Client, map[string]*Gallery) {
+	h := stub.New()
+	for id, script := range scripts {
+		h.SetGallery(id, script)
+	}
+	client := NewClient(DefaultOptions().WithClient(h.Client()))
+	galleries := map[string]*Gallery{}
+	for id := range scripts {
+		g, err := client.Gallery(strconv.Itoa(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		galleries[g.Id] = g
+	}
+	return client, galleries
+}
+
+func TestGalleryScript_Normalize_Video(t *testing.T) {
+	g := new(galleryScript)
+	err := json.Unmarshal([]byte(`{"id":"123","type":"anime","galleryurl":"/anime/foo-123.html",`+
+		`"videofilename":"foo.mp4","video":"foo","scene_indexes":[0,"120",300]}`), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gallery := g.Normalize()
+	if gallery.Type != GalleryTypeAnime || !gallery.HasVideo() {
+		t.Fatalf("unexpected gallery: %s", pp(gallery))
+	}
+	if got := gallery.VideoURL(); got != "https://streaming.hitomi.la/videos/foo.mp4" {
+		t.Errorf("VideoURL() = %q", got)
+	}
+	if got := gallery.VideoPosterURL(); got != "https://tn.hitomi.la/videos/foo.jpg" {
+		t.Errorf("VideoPosterURL() = %q", got)
+	}
+	if len(gallery.SceneIndexes) != 3 || gallery.SceneIndexes[1] != 120 {
+		t.Errorf("SceneIndexes = %v", gallery.SceneIndexes)
+	}
+}
+
+func TestClient_Download(t *testing.T) {
+	c := NewClient(DefaultOptions().WithClient(stub.Client(func(req *http.Request) *http.Response {
+		if req.Header.Get("Referer") != "https://hitomi.la/anime/foo-123.html" {
+			return stub.Response(403, "")
+		}
+		return stub.Response(200, "video")
+	})))
+	req, err := c.VideoRequest(&Gallery{Id: "123", GalleryUrl: "/anime/foo-123.html", VideoFilename: "foo.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	var written, total int64
+	n, err := c.Download(req, buf, func(w, t int64) { written, total = w, t })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || written != 5 || total != 5 || buf.String() != "video" {
+		t.Errorf("Download: n=%d written=%d total=%d body=%q", n, written, total, buf.String())
+	}
+	if _, err := c.VideoRequest(&Gallery{Id: "1"}); err == nil {
+		t.Error("VideoRequest without video succeeded")
+	}
+}
+
+func TestClient_FileURL_Concurrent(t *testing.T) {
+	h := stub.New()
+	c := NewClient(DefaultOptions().WithClient(h.Client()).WithUpdateScriptInterval(0))
+	if got := NewClient(DefaultOptions().WithClient(stub.Client(func(*http.Request) *http.Response {
+		return stub.Response(503, "")
+	}))).FileURL(strings.Repeat("0", 64)); got != "" {
+		t.Errorf("FileURL without gg.js = %q", got)
+	}
+	// every call updates gg.js, which must not race with calculating urls
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if url := c.FileURL(strings.Repeat("0", 64)); !strings.HasPrefix(url, "https://") {
+					t.Errorf("FileURL = %q", url)
+				}
+				_ = c.UpdateScript()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,84 @@
+// Command hitomi-server serves hitomi galleries, searches and images over an HTTP JSON API.
+// See package server for the endpoints.
+//
+// Usage:
+//
+//	hitomi-server [-addr host:port] [-cache dir] [-cache-size MiB] [-library dir] [-base-url url] [-filter file] [-debug]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/library"
+	"github.com/EINNN7/hitomi/server"
+	"github.com/rs/zerolog"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	cacheDir := flag.String("cache", "", "directory to cache proxied images in, not cached if empty")
+	cacheSize := flag.Int64("cache-size", 1024, "maximum size of image cache in MiB")
+	libraryDir := flag.String("library", "", "library directory listed by OPDS feeds instead of live search")
+	baseURL := flag.String("base-url", "", "url prepended to links in OPDS feeds, if the server is behind a proxy")
+	filterPath := flag.String("filter", "", "json file of filter excluding galleries from responses")
+	debug := flag.Bool("debug", false, "print debug logs")
+	flag.Parse()
+
+	opts := hitomi.DefaultOptions()
+	if *debug {
+		opts = opts.WithLogger(opts.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.DebugLevel))
+	}
+	serverOpts := server.DefaultOptions().WithBaseURL(*baseURL)
+	if *libraryDir != "" {
+		l, err := library.Open(*libraryDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hitomi-server: %v\n", err)
+			os.Exit(1)
+		}
+		serverOpts = serverOpts.WithLibrary(l)
+	}
+	if *filterPath != "" {
+		f, err := hitomi.LoadFilter(*filterPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hitomi-server: %v\n", err)
+			os.Exit(1)
+		}
+		serverOpts = serverOpts.WithFilter(f)
+	}
+	if *cacheDir != "" {
+		cache, err := server.NewFileCache(*cacheDir, *cacheSize<<20)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hitomi-server: %v\n", err)
+			os.Exit(1)
+		}
+		serverOpts = serverOpts.WithCache(cache)
+	}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           server.New(opts, serverOpts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "hitomi-server: listening on %s\n", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "hitomi-server: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/EINNN7/hitomi"
+)
+
+func runDownload(args []string) error {
+	fs := newFlagSet("download")
+	dir := fs.String("o", ".", "output directory, galleries are saved in <dir>/<id>")
+	concurrency := fs.Int("c", 4, "number of gallery information fetched at once")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	var ids []int
+	for _, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid id: %s", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	client := hitomi.NewClient(options())
+	if err := client.UpdateScript(); err != nil {
+		return err
+	}
+	var failed int
+	opts := hitomi.DefaultBatchOptions().WithConcurrency(*concurrency).WithOrdered(true).WithFilter(f)
+	for result := range client.Galleries(context.Background(), ids, opts) {
+		if errors.Is(result.Err, hitomi.ErrExcluded) {
+			fmt.Fprintf(os.Stderr, "%d: %v, skipped\n", result.Id, result.Err)
+			continue
+		}
+		if result.Err == nil {
+			result.Err = downloadGallery(client, result.Gallery, filepath.Join(*dir, strconv.Itoa(result.Id)))
+		}
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "%d: %v\n", result.Id, result.Err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to download %d of %d galleries", failed, len(ids))
+	}
+	return nil
+}
+
+func downloadGallery(client *hitomi.Client, g *hitomi.Gallery, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if g.HasVideo() {
+		req, err := client.VideoRequest(g)
+		if err != nil {
+			return err
+		}
+		if err := checkName(g.VideoFilename); err != nil {
+			return err
+		}
+		return downloadFile(client, req, filepath.Join(dir, g.VideoFilename), g.Id+" video")
+	}
+	for i, file := range g.Files {
+		name := fmt.Sprintf("%03d_%s.webp", i+1, strings.TrimSuffix(file.Name, filepath.Ext(file.Name)))
+		if err := checkName(name); err != nil {
+			return err
+		}
+		label := fmt.Sprintf("%s %d/%d", g.Id, i+1, len(g.Files))
+		if err := downloadFile(client, client.FileRequest(client.FileURL(file.Hash), g.Id), filepath.Join(dir, name), label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkName returns an error if name given by hitomi is not a single path element,
+// which could otherwise write files outside of the gallery directory.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.Base(name) != name {
+		return fmt.Errorf("invalid file name: %q", name)
+	}
+	return nil
+}
+
+// downloadFile downloads req into path, printing progress with label.
+// Existing files are skipped.
+func downloadFile(client *hitomi.Client, req *http.Request, path, label string) error {
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(os.Stderr, "%s: %s exists, skipped\n", label, filepath.Base(path))
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	_, err = client.Download(req, f, func(written, total int64) {
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s: %s %3d%%", label, filepath.Base(path), written*100/total)
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s: %s %d KiB", label, filepath.Base(path), written/1024)
+		}
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
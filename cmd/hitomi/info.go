@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EINNN7/hitomi"
+)
+
+func runInfo(args []string) error {
+	fs := newFlagSet("info")
+	asJSON := fs.Bool("json", false, "print as json")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	gallery, err := hitomi.NewClient(options()).Gallery(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(gallery)
+	}
+	return printGallery(gallery)
+}
+
+func printGallery(g *hitomi.Gallery) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	row := func(key, value string) {
+		if value != "" {
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", key, value)
+		}
+	}
+	row("ID", g.Id)
+	row("Title", g.Title)
+	if g.JapaneseTitle != nil {
+		row("Japanese Title", *g.JapaneseTitle)
+	}
+	row("Type", g.Type.String())
+	row("Language", g.Language)
+	if !g.Published.IsZero() {
+		row("Published", g.Published.Format("2006-01-02 15:04:05 -07:00"))
+	}
+	var artists, groups, parodies, characters, tags []string
+	for _, a := range g.Artists {
+		artists = append(artists, a.Artist)
+	}
+	for _, gr := range g.Groups {
+		groups = append(groups, gr.Group)
+	}
+	for _, p := range g.Parodies {
+		parodies = append(parodies, p.Parody)
+	}
+	for _, c := range g.Characters {
+		characters = append(characters, c.Character)
+	}
+	for _, t := range g.Tags {
+		tags = append(tags, t.String())
+	}
+	row("Artists", strings.Join(artists, ", "))
+	row("Groups", strings.Join(groups, ", "))
+	row("Series", strings.Join(parodies, ", "))
+	row("Characters", strings.Join(characters, ", "))
+	row("Tags", strings.Join(tags, " "))
+	row("Pages", fmt.Sprint(len(g.Files)))
+	if g.HasVideo() {
+		row("Video", g.VideoURL())
+	}
+	row("URL", "https://hitomi.la"+g.GalleryUrl)
+	return w.Flush()
+}
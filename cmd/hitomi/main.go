@@ -0,0 +1,112 @@
+// Command hitomi is a command-line client for hitomi.la.
+//
+// Usage:
+//
+//	hitomi [-debug] [-filter file] <command> [arguments]
+//
+//	hitomi info [-json] <id>
+//	hitomi search [-json] [-page n] [-size n] [-titles] [-prefer languages] <query>
+//	hitomi suggest [-json] <[field:]prefix>
+//	hitomi download [-o dir] [-c n] <id...>
+//	hitomi url <hash>
+//	hitomi related [-depth n] [-max n] [-translations=false] [-dot] <id...>
+//	hitomi watch [-i interval] [-state file] [-o dir] [-webhook url] [-discord url] [-jsonl file] <query...>
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/rs/zerolog"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"info", "info [-json] <id>", runInfo},
+	{"search", "search [-json] [-page n] [-size n] [-titles] [-prefer languages] <query>", runSearch},
+	{"suggest", "suggest [-json] <[field:]prefix>", runSuggest},
+	{"download", "download [-o dir] [-c n] <id...>", runDownload},
+	{"url", "url <hash>", runURL},
+	{"related", "related [-depth n] [-max n] [-translations=false] [-dot] <id...>", runRelated},
+	{"watch", "watch [-i interval] [-state file] [-o dir] [-webhook url] [-discord url] [-jsonl file] <query...>", runWatch},
+}
+
+// errUsage is returned by commands when arguments are invalid.
+var errUsage = errors.New("invalid arguments")
+
+var (
+	debug      = flag.Bool("debug", false, "print debug logs")
+	filterPath = flag.String("filter", "", "json file of filter excluding galleries from search, download and watch")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: hitomi [-debug] [-filter file] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  hitomi %s\n", c.usage)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != flag.Arg(0) {
+			continue
+		}
+		if err := c.run(flag.Args()[1:]); err != nil {
+			if err == errUsage {
+				fmt.Fprintf(os.Stderr, "usage: hitomi %s\n", c.usage)
+				os.Exit(2)
+			}
+			fmt.Fprintf(os.Stderr, "hitomi %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "hitomi: unknown command %q\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+func options() *hitomi.Options {
+	opts := hitomi.DefaultOptions()
+	if *debug {
+		opts = opts.WithLogger(opts.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.DebugLevel))
+	}
+	return opts
+}
+
+// filter returns filter loaded from -filter, or nil if it is not set.
+func filter() (*hitomi.Filter, error) {
+	if *filterPath == "" {
+		return nil, nil
+	}
+	return hitomi.LoadFilter(*filterPath)
+}
+
+// newFlagSet returns a flag set for the command, which reports errUsage on invalid flags.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {}
+	return fs
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
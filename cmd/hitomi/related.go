@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/crawl"
+)
+
+func runRelated(args []string) error {
+	fs := newFlagSet("related")
+	depth := fs.Int("depth", crawl.DefaultOptions().MaxDepth, "maximum number of links followed")
+	maxNodes := fs.Int("max", crawl.DefaultOptions().MaxNodes, "maximum number of galleries, 0 for no limit")
+	translations := fs.Bool("translations", true, "follow translations")
+	dot := fs.Bool("dot", false, "print as graphviz dot instead of json")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	var roots []int
+	for _, arg := range fs.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid id: %s", arg)
+		}
+		roots = append(roots, id)
+	}
+
+	opts := crawl.DefaultOptions().WithMaxDepth(*depth).WithMaxNodes(*maxNodes).WithTranslations(*translations)
+	graph, err := crawl.Crawl(context.Background(), hitomi.NewClient(options()), roots, opts)
+	if err != nil {
+		return err
+	}
+	if *dot {
+		return graph.WriteDOT(os.Stdout)
+	}
+	return graph.WriteJSON(os.Stdout)
+}
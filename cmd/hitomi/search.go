@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EINNN7/hitomi"
+)
+
+func runSearch(args []string) error {
+	fs := newFlagSet("search")
+	asJSON := fs.Bool("json", false, "print as json")
+	page := fs.Int("page", 0, "page to print, starting from 0")
+	size := fs.Int("size", 25, "number of galleries per page")
+	titles := fs.Bool("titles", false, "fetch and print gallery titles")
+	prefer := fs.String("prefer", "", "comma separated languages, like korean,english; with -titles, each work is printed once in the first available language")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	opts := options()
+	result, err := hitomi.NewSearch(opts).Query(f.Query(strings.Join(fs.Args(), " ")))
+	if err != nil {
+		return err
+	}
+	ids := result.Page(*page, *size)
+
+	// Filter.Query only narrows the query down, so ids are checked with their metadata whenever a filter is set
+	var galleries []*hitomi.Gallery
+	var allowed []int
+	client := hitomi.NewClient(opts)
+	if *titles || f != nil {
+		for r := range client.Galleries(context.Background(), ids, hitomi.DefaultBatchOptions().WithOrdered(true).WithFilter(f)) {
+			if r.Err != nil {
+				fmt.Fprintln(os.Stderr, r.Err)
+				continue
+			}
+			galleries = append(galleries, r.Gallery)
+			allowed = append(allowed, r.Id)
+		}
+	}
+
+	if !*titles {
+		if f != nil {
+			ids = allowed
+		}
+		if *asJSON {
+			return printJSON(struct {
+				Query string
+				Total int
+				IDs   []int
+			}{result.Query, result.Total(), ids})
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	}
+
+	if *prefer != "" {
+		galleries, err = client.PreferTranslations(context.Background(), galleries, strings.Split(*prefer, ","), hitomi.DefaultBatchOptions().WithFilter(f))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if *asJSON {
+		return printJSON(struct {
+			Query     string
+			Total     int
+			Galleries []*hitomi.Gallery
+		}{result.Query, result.Total(), galleries})
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, g := range galleries {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", g.Id, g.Type, g.Language, g.Title)
+	}
+	return w.Flush()
+}
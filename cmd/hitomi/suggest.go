@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EINNN7/hitomi"
+)
+
+func runSuggest(args []string) error {
+	fs := newFlagSet("suggest")
+	asJSON := fs.Bool("json", false, "print as json")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	search := hitomi.NewSearch(options())
+	var suggestions []hitomi.Suggestion
+	var err error
+	if strings.Contains(fs.Arg(0), ":") {
+		suggestions, err = search.TagSuggestion(fs.Arg(0))
+	} else {
+		suggestions, err = search.Suggest(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(suggestions)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, s := range suggestions {
+		_, _ = fmt.Fprintf(w, "%d\t %s\n", s.Count, s)
+	}
+	return w.Flush()
+}
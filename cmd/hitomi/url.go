@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/EINNN7/hitomi"
+)
+
+func runURL(args []string) error {
+	fs := newFlagSet("url")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	client := hitomi.NewClient(options())
+	if err := client.UpdateScript(); err != nil {
+		return err
+	}
+	fmt.Println(client.FileURL(fs.Arg(0)))
+	return nil
+}
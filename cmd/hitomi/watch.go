@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/watch"
+)
+
+func runWatch(args []string) error {
+	fs := newFlagSet("watch")
+	interval := fs.Duration("i", watch.DefaultOptions().Interval, "time between checks")
+	state := fs.String("state", "", "file to save seen galleries, so that restarts do not report them again")
+	dir := fs.String("o", "", "download new galleries into <dir>/<id> if set")
+	webhook := fs.String("webhook", "", "post new galleries as json to url")
+	discord := fs.String("discord", "", "post new galleries to discord webhook url")
+	jsonl := fs.String("jsonl", "", "append new galleries as json lines to file")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	opts := options()
+	client := hitomi.NewClient(opts)
+	watchOpts := watch.DefaultOptions().WithInterval(*interval).WithStatePath(*state).WithFilter(f).
+		WithError(func(err error) {
+			fmt.Fprintln(os.Stderr, err)
+		})
+	if *dir != "" {
+		watchOpts = watchOpts.WithDownload(func(ctx context.Context, g *hitomi.Gallery) error {
+			// gg.js changes over time, so refresh it before each gallery
+			if err := client.UpdateScript(); err != nil {
+				return err
+			}
+			if err := checkName(g.Id); err != nil {
+				return err
+			}
+			return downloadGallery(client, g, filepath.Join(*dir, g.Id))
+		})
+	}
+	w, err := watch.New(opts, watchOpts)
+	if err != nil {
+		return err
+	}
+	for _, query := range fs.Args() {
+		if _, err := hitomi.ParseQuery(query); err != nil {
+			return err
+		}
+		w.Subscribe(watch.Query(query))
+	}
+
+	// each sink is deduplicated on its own, so that a failing sink does not make the others send again
+	sinks := []watch.Sink{watch.Dedupe(watch.SinkFunc(func(_ context.Context, event watch.Event) error {
+		fmt.Printf("%s\t%s\t%s\n", event.Subscription.Name, event.Gallery.Id, event.Gallery.Title)
+		return nil
+	}))}
+	if *webhook != "" {
+		sinks = append(sinks, watch.Dedupe(watch.Retry(&watch.Webhook{URL: *webhook}, 3, time.Second)))
+	}
+	if *discord != "" {
+		sinks = append(sinks, watch.Dedupe(watch.Retry(&watch.Discord{URL: *discord}, 3, time.Second)))
+	}
+	if *jsonl != "" {
+		sink, closer, err := watch.OpenJSONLines(*jsonl)
+		if err != nil {
+			return err
+		}
+		defer func(closer io.Closer) {
+			_ = closer.Close()
+		}(closer)
+		sinks = append(sinks, watch.Dedupe(sink))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = w.Run(ctx, watch.Handler(ctx, watch.Multi(sinks...), watchOpts.Error))
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
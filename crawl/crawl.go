@@ -0,0 +1,280 @@
+// Package crawl follows links between galleries and builds a graph of them.
+package crawl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// Options are options for Crawl.
+type Options struct {
+	// MaxDepth is the maximum number of links followed from the roots.
+	// Galleries at MaxDepth are fetched but their links are not followed.
+	MaxDepth int
+
+	// MaxNodes is the maximum number of galleries in the graph, or 0 for no limit.
+	MaxNodes int
+
+	// Related is an option to follow Gallery.Related.
+	Related bool
+
+	// Translations is an option to follow Gallery.Languages.
+	Translations bool
+
+	// Batch is used to fetch galleries of each depth.
+	Batch *hitomi.BatchOptions
+}
+
+func (o *Options) WithMaxDepth(n int) *Options {
+	o.MaxDepth = n
+	return o
+}
+
+func (o *Options) WithMaxNodes(n int) *Options {
+	o.MaxNodes = n
+	return o
+}
+
+func (o *Options) WithRelated(b bool) *Options {
+	o.Related = b
+	return o
+}
+
+func (o *Options) WithTranslations(b bool) *Options {
+	o.Translations = b
+	return o
+}
+
+func (o *Options) WithBatch(opts *hitomi.BatchOptions) *Options {
+	o.Batch = opts
+	return o
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		MaxDepth:     2,
+		MaxNodes:     200,
+		Related:      true,
+		Translations: true,
+		Batch:        hitomi.DefaultBatchOptions().WithOrdered(true),
+	}
+}
+
+// EdgeKind is the kind of link between galleries.
+type EdgeKind string
+
+const (
+	// EdgeRelated links a gallery to one of its Related galleries.
+	EdgeRelated EdgeKind = "related"
+	// EdgeTranslation links translations of the same gallery.
+	// It is undirected, and From is always less than To.
+	EdgeTranslation EdgeKind = "translation"
+)
+
+// Node is a gallery in graph.
+type Node struct {
+	ID int `json:"id"`
+	// Depth is the number of links from the nearest root.
+	Depth int `json:"depth"`
+	// Gallery is nil if it failed to fetch.
+	Gallery *hitomi.Gallery `json:"gallery,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Edge is a link between galleries.
+type Edge struct {
+	From int      `json:"from"`
+	To   int      `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// Graph is a graph of galleries.
+type Graph struct {
+	// Nodes are in the order they were discovered, roots first.
+	Nodes []*Node `json:"nodes"`
+	// Edges only link nodes in the graph.
+	Edges []Edge `json:"edges"`
+}
+
+// Crawl fetches roots and galleries linked from them breadth first, within limits of opts.
+// Galleries which failed to fetch are kept in the graph with their error,
+// so the returned error is only about ctx.
+func Crawl(ctx context.Context, client *hitomi.Client, roots []int, opts *Options) (*Graph, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	graph := &Graph{}
+	nodes := map[int]*Node{}
+	// discover adds node of id if it is new and the graph is not full, reporting whether it is in the graph.
+	discover := func(id, depth int) bool {
+		if _, ok := nodes[id]; ok {
+			return true
+		}
+		if opts.MaxNodes > 0 && len(nodes) >= opts.MaxNodes {
+			return false
+		}
+		node := &Node{ID: id, Depth: depth}
+		nodes[id] = node
+		graph.Nodes = append(graph.Nodes, node)
+		return true
+	}
+	edges := map[Edge]struct{}{}
+	link := func(from, to int, kind EdgeKind) {
+		if kind == EdgeTranslation && from > to {
+			from, to = to, from
+		}
+		edge := Edge{From: from, To: to, Kind: kind}
+		if _, ok := edges[edge]; ok || from == to {
+			return
+		}
+		edges[edge] = struct{}{}
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	var level []int
+	for _, id := range roots {
+		if _, ok := nodes[id]; !ok && discover(id, 0) {
+			level = append(level, id)
+		}
+	}
+	for depth := 0; len(level) > 0; depth++ {
+		var next []int
+		// links to galleries fetched later are added after the whole level is fetched,
+		// so that edges only refer to nodes in the graph
+		type pending struct {
+			from, to int
+			kind     EdgeKind
+		}
+		var links []pending
+		for result := range client.Galleries(ctx, level, opts.Batch) {
+			node := nodes[result.Id]
+			if result.Err != nil {
+				node.Error = result.Err.Error()
+				continue
+			}
+			node.Gallery = result.Gallery
+			if depth >= opts.MaxDepth {
+				continue
+			}
+			for _, to := range linkedIDs(result.Gallery, opts) {
+				links = append(links, pending{from: result.Id, to: to.id, kind: to.kind})
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return graph, err
+		}
+		for _, l := range links {
+			_, known := nodes[l.to]
+			if !discover(l.to, depth+1) {
+				continue
+			}
+			if !known {
+				next = append(next, l.to)
+			}
+			link(l.from, l.to, l.kind)
+		}
+		level = next
+	}
+
+	// links of the deepest galleries are not followed, but still link galleries already in the graph
+	for _, node := range graph.Nodes {
+		if node.Gallery == nil || node.Depth < opts.MaxDepth {
+			continue
+		}
+		for _, to := range linkedIDs(node.Gallery, opts) {
+			if _, ok := nodes[to.id]; ok {
+				link(node.ID, to.id, to.kind)
+			}
+		}
+	}
+	return graph, nil
+}
+
+type linkedID struct {
+	id   int
+	kind EdgeKind
+}
+
+// linkedIDs returns ids linked from gallery, which are followed by opts.
+func linkedIDs(g *hitomi.Gallery, opts *Options) []linkedID {
+	var ids []linkedID
+	if opts.Translations {
+		for _, language := range g.Languages {
+			if id, err := strconv.Atoi(language.GalleryId); err == nil {
+				ids = append(ids, linkedID{id: id, kind: EdgeTranslation})
+			}
+		}
+	}
+	if opts.Related {
+		for _, related := range g.Related {
+			if id, err := strconv.Atoi(related); err == nil {
+				ids = append(ids, linkedID{id: id, kind: EdgeRelated})
+			}
+		}
+	}
+	return ids
+}
+
+// Node returns node of id.
+func (g *Graph) Node(id int) (*Node, bool) {
+	i := slices.IndexFunc(g.Nodes, func(node *Node) bool { return node.ID == id })
+	if i < 0 {
+		return nil, false
+	}
+	return g.Nodes[i], true
+}
+
+// WriteJSON writes graph as JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
+
+// WriteDOT writes graph in Graphviz DOT language.
+// Related edges are solid arrows, and translation edges are dashed lines.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph galleries {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, node := range g.Nodes {
+		label := strconv.Itoa(node.ID)
+		if node.Gallery != nil {
+			label = fmt.Sprintf("%s\n%d %s", node.Gallery.Title, node.ID, node.Gallery.Language)
+		}
+		attrs := "label=" + dotQuote(label)
+		if node.Depth == 0 {
+			attrs += ", style=bold"
+		}
+		if node.Gallery == nil {
+			attrs += ", color=gray"
+		}
+		fmt.Fprintf(&b, "\t%d [%s];\n", node.ID, attrs)
+	}
+	for _, edge := range g.Edges {
+		switch edge.Kind {
+		case EdgeTranslation:
+			fmt.Fprintf(&b, "\t%d -> %d [style=dashed, dir=none];\n", edge.From, edge.To)
+		default:
+			fmt.Fprintf(&b, "\t%d -> %d;\n", edge.From, edge.To)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,88 @@
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+// testScripts are gallery scripts by id, without galleryinfo prefix.
+var testScripts = map[int]string{
+	1: `{"id": 1, "title": "one", "language": "japanese", "related": [2, 3], "languages": [{"galleryid": "1"}, {"galleryid": "4"}]}`,
+	2: `{"id": 2, "title": "two", "related": [5]}`,
+	3: `{"id": 3, "title": "th\"ree", "related": [1]}`,
+	4: `{"id": 4, "title": "one", "language": "english", "languages": [{"galleryid": "1"}, {"galleryid": "4"}]}`,
+	5: `{"id": 5, "title": "five", "related": [6]}`,
+}
+
+func newTestClient() *hitomi.Client {
+	h := stub.New()
+	for id, script := range testScripts {
+		h.SetGallery(id, script)
+	}
+	return hitomi.NewClient(hitomi.DefaultOptions().WithClient(h.Client()))
+}
+
+func summary(g *Graph) string {
+	var nodes, edges []string
+	for _, node := range g.Nodes {
+		s := fmt.Sprintf("%d@%d", node.ID, node.Depth)
+		if node.Gallery == nil {
+			s += "!"
+		}
+		nodes = append(nodes, s)
+	}
+	for _, edge := range g.Edges {
+		sep := "->"
+		if edge.Kind == EdgeTranslation {
+			sep = "--"
+		}
+		edges = append(edges, fmt.Sprintf("%d%s%d", edge.From, sep, edge.To))
+	}
+	return strings.Join(nodes, " ") + " | " + strings.Join(edges, " ")
+}
+
+func TestCrawl(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+		want string
+	}{
+		{"default", DefaultOptions(), "1@0 4@1 2@1 3@1 5@2 | 1--4 1->2 1->3 2->5 3->1"},
+		{"max nodes", DefaultOptions().WithMaxNodes(3), "1@0 4@1 2@1 | 1--4 1->2"},
+		{"depth 3", DefaultOptions().WithMaxDepth(3), "1@0 4@1 2@1 3@1 5@2 6@3! | 1--4 1->2 1->3 2->5 3->1 5->6"},
+		{"related only", DefaultOptions().WithTranslations(false).WithMaxDepth(1), "1@0 2@1 3@1 | 1->2 1->3 3->1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := Crawl(context.Background(), newTestClient(), []int{1}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summary(graph); got != tt.want {
+				t.Errorf("graph = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraph_WriteDOT(t *testing.T) {
+	graph, err := Crawl(context.Background(), newTestClient(), []int{3}, DefaultOptions().WithMaxDepth(1).WithTranslations(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := graph.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`3 [label="th\"ree\n3 ", style=bold];`, "3 -> 1;", "1 -> 3;"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("DOT does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
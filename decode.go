@@ -0,0 +1,217 @@
+package hitomi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrCorruptIndex is returned when index data can not be decoded,
+// usually because a response is truncated or is not index data at all.
+var ErrCorruptIndex = errors.New("corrupt index")
+
+// CorruptIndexError reports where index data is corrupt.
+type CorruptIndexError struct {
+	Offset int
+	Reason string
+}
+
+func (e *CorruptIndexError) Error() string {
+	return fmt.Sprintf("corrupt index at offset %d: %s", e.Offset, e.Reason)
+}
+
+func (e *CorruptIndexError) Is(target error) bool {
+	return target == ErrCorruptIndex
+}
+
+// binaryReader reads big-endian values from data without reading past its end.
+type binaryReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *binaryReader) corrupt(format string, a ...any) error {
+	return &CorruptIndexError{Offset: r.pos, Reason: fmt.Sprintf(format, a...)}
+}
+
+func (r *binaryReader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *binaryReader) bytes(n int, what string) ([]byte, error) {
+	if n < 0 || n > r.remaining() {
+		return nil, r.corrupt("%s needs %d bytes, %d left", what, n, r.remaining())
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *binaryReader) uint32(what string) (uint32, error) {
+	b, err := r.bytes(4, what)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (r *binaryReader) uint64(what string) (uint64, error) {
+	b, err := r.bytes(8, what)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// count reads a uint32 count of elements, each of which takes at least size bytes.
+func (r *binaryReader) count(size int, what string) (int, error) {
+	start := r.pos
+	v, err := r.uint32(what)
+	if err != nil {
+		return 0, err
+	}
+	if int64(v)*int64(size) > int64(r.remaining()) {
+		r.pos = start
+		return 0, r.corrupt("%s %d exceeds %d bytes left", what, v, r.remaining()-4)
+	}
+	return int(v), nil
+}
+
+type node struct {
+	Key            [][]byte
+	Data           [][2]int
+	SubNodeAddress []int
+}
+
+// nodeSlice returns node data at address of whole index, which is at most MaxNodeSize bytes.
+func nodeSlice(index []byte, address int) []byte {
+	if address < 0 || address >= len(index) {
+		return nil
+	}
+	return index[address:min(address+MaxNodeSize, len(index))]
+}
+
+func decodeNode(data []byte) (*node, error) {
+	node := new(node)
+	node.Key = [][]byte{}
+	node.Data = [][2]int{}
+	node.SubNodeAddress = []int{}
+
+	r := &binaryReader{data: data}
+	keyLength, err := r.count(4, "key count")
+	if err != nil {
+		return nil, err
+	}
+	if keyLength > 16 {
+		return nil, r.corrupt("too many keys: %d", keyLength)
+	}
+	for i := 0; i < keyLength; i++ {
+		keySize, err := r.uint32("key size")
+		if err != nil {
+			return nil, err
+		}
+		if keySize == 0 || keySize > 32 {
+			return nil, r.corrupt("invalid key size: %d", keySize)
+		}
+		key, err := r.bytes(int(keySize), "key")
+		if err != nil {
+			return nil, err
+		}
+		node.Key = append(node.Key, key)
+	}
+
+	dataLength, err := r.count(12, "data count")
+	if err != nil {
+		return nil, err
+	}
+	if dataLength != keyLength {
+		return nil, r.corrupt("data count %d does not match key count %d", dataLength, keyLength)
+	}
+	for i := 0; i < dataLength; i++ {
+		offset, err := r.uint64("data offset")
+		if err != nil {
+			return nil, err
+		}
+		length, err := r.uint32("data length")
+		if err != nil {
+			return nil, err
+		}
+		if offset > 1<<53 || length > 1<<30 {
+			return nil, r.corrupt("invalid data: offset %d, length %d", offset, length)
+		}
+		node.Data = append(node.Data, [2]int{int(offset), int(length)})
+	}
+
+	for i := 0; i < 16+1; i++ {
+		subNodeAddress, err := r.uint64("sub node address")
+		if err != nil {
+			return nil, err
+		}
+		if subNodeAddress > 1<<53 {
+			return nil, r.corrupt("invalid sub node address: %d", subNodeAddress)
+		}
+		node.SubNodeAddress = append(node.SubNodeAddress, int(subNodeAddress))
+	}
+
+	return node, nil
+}
+
+// decodeSuggestions decodes suggestions in tagindex data.
+func decodeSuggestions(data []byte) ([]Suggestion, error) {
+	r := &binaryReader{data: data}
+	suggestionLength, err := r.count(12, "suggestion count")
+	if err != nil {
+		return nil, err
+	}
+	var suggestions = make([]Suggestion, suggestionLength)
+	for i := 0; i < suggestionLength; i++ {
+		headerLength, err := r.count(1, "namespace length")
+		if err != nil {
+			return nil, err
+		}
+		header, err := r.bytes(headerLength, "namespace")
+		if err != nil {
+			return nil, err
+		}
+		tagLength, err := r.count(1, "tag length")
+		if err != nil {
+			return nil, err
+		}
+		tag, err := r.bytes(tagLength, "tag")
+		if err != nil {
+			return nil, err
+		}
+		count, err := r.uint32("gallery count")
+		if err != nil {
+			return nil, err
+		}
+		suggestions[i] = Suggestion{Tag: Tag{Namespace: string(header), Name: string(tag)}, Count: int(int32(count))}
+	}
+	return suggestions, nil
+}
+
+// decodeNozomi decodes a nozomi file, which is a list of big-endian int32 gallery ids.
+func decodeNozomi(data []byte) ([]int, error) {
+	if len(data)%4 != 0 {
+		return nil, &CorruptIndexError{Offset: len(data) - len(data)%4, Reason: fmt.Sprintf("nozomi length %d is not a multiple of 4", len(data))}
+	}
+	ids := make([]int, len(data)/4)
+	for i := range ids {
+		ids[i] = int(int32(binary.BigEndian.Uint32(data[i*4 : i*4+4])))
+	}
+	return ids, nil
+}
+
+// decodeGalleriesData decodes gallery ids in galleries.data of galleriesindex,
+// which is a count followed by ids.
+func decodeGalleriesData(data []byte) ([]int, error) {
+	r := &binaryReader{data: data}
+	count, err := r.count(4, "gallery count")
+	if err != nil {
+		return nil, err
+	}
+	if r.remaining() != count*4 {
+		return nil, r.corrupt("%d bytes left for %d ids", r.remaining(), count)
+	}
+	return decodeNozomi(data[r.pos:])
+}
@@ -0,0 +1,130 @@
+package hitomi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+func TestDecode_Corrupt(t *testing.T) {
+	valid := encodeNode([][]byte{{1, 2, 3, 4}}, [][2]int{{100, 20}}, []int{0, 464})
+	for _, data := range [][]byte{
+		nil,
+		[]byte("<html><body>503 Service Unavailable</body></html>"),
+		valid[:len(valid)-1],
+		valid[:10],
+	} {
+		_, err := decodeNode(data)
+		var corrupt *CorruptIndexError
+		if !errors.As(err, &corrupt) || !errors.Is(err, ErrCorruptIndex) {
+			t.Errorf("decodeNode(%q) error = %v, want ErrCorruptIndex", data, err)
+		}
+	}
+
+	suggestions := encodeSuggestions([]Suggestion{{Tag{"female", "big breasts"}, 1000}})
+	_, err := decodeSuggestions(suggestions[:len(suggestions)-2])
+	var corrupt *CorruptIndexError
+	if !errors.As(err, &corrupt) || corrupt.Offset != len(suggestions)-4 {
+		t.Errorf("decodeSuggestions(truncated) error = %v", err)
+	}
+
+	if _, err := decodeNozomi([]byte{0, 0, 0, 1, 0}); !errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("decodeNozomi(truncated) error = %v", err)
+	}
+	if _, err := decodeGalleriesData([]byte{0, 0, 0, 2, 0, 0, 0, 1}); !errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("decodeGalleriesData(truncated) error = %v", err)
+	}
+}
+
+func FuzzDecodeNode(f *testing.F) {
+	f.Add(encodeNode(nil, nil, nil))
+	f.Add(encodeNode([][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}}, [][2]int{{100, 20}, {200, 30}}, []int{0, 464, 928}))
+	f.Add([]byte("<html></html>"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node, err := decodeNode(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorruptIndex) {
+				t.Fatalf("error is not ErrCorruptIndex: %v", err)
+			}
+			return
+		}
+		if len(node.Key) != len(node.Data) || len(node.SubNodeAddress) != 17 {
+			t.Fatalf("invalid node: %d keys, %d data, %d sub nodes", len(node.Key), len(node.Data), len(node.SubNodeAddress))
+		}
+		if encoded := encodeNode(node.Key, node.Data, node.SubNodeAddress); !bytes.Equal(encoded, data[:len(encoded)]) {
+			t.Fatalf("node does not round trip")
+		}
+	})
+}
+
+func FuzzDecodeSuggestions(f *testing.F) {
+	f.Add(encodeSuggestions(nil))
+	f.Add(encodeSuggestions([]Suggestion{{Tag{"female", "big breasts"}, 1000}, {Tag{"tag", "big ass"}, 300}}))
+	f.Add([]byte("<html></html>"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		suggestions, err := decodeSuggestions(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorruptIndex) {
+				t.Fatalf("error is not ErrCorruptIndex: %v", err)
+			}
+			return
+		}
+		if encoded := encodeSuggestions(suggestions); !bytes.Equal(encoded, data[:len(encoded)]) {
+			t.Fatalf("suggestions do not round trip")
+		}
+	})
+}
+
+func FuzzDecodeNozomi(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 1, 0, 0, 0, 2})
+	f.Add([]byte("<html></html>"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ids, err := decodeNozomi(data)
+		if err != nil {
+			if !errors.Is(err, ErrCorruptIndex) {
+				t.Fatalf("error is not ErrCorruptIndex: %v", err)
+			}
+			return
+		}
+		encoded := make([]byte, 0, len(data))
+		for _, id := range ids {
+			encoded = binary.BigEndian.AppendUint32(encoded, uint32(id))
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("nozomi does not round trip")
+		}
+		if galleries, err := decodeGalleriesData(append(binary.BigEndian.AppendUint32(nil, uint32(len(ids))), data...)); err != nil || !slices.Equal(galleries, ids) {
+			t.Fatalf("galleries data does not round trip: %v", err)
+		}
+	})
+}
+
+func TestSearch_CorruptSubNode(t *testing.T) {
+	root := encodeNode(nil, nil, []int{464})
+	h := stub.New()
+	h.Handle(func(req *http.Request) *http.Response {
+		if !strings.HasSuffix(req.URL.Path, ".index") {
+			return nil
+		}
+		if strings.HasPrefix(req.Header.Get("Range"), "bytes=0-") {
+			return stub.Response(200, string(root))
+		}
+		return stub.Response(200, "<html><body>503 Service Unavailable</body></html>")
+	})
+	s := NewSearch(DefaultOptions().WithClient(h.Client()))
+	_, err := s.TagSuggestion("female:big")
+	var corrupt *CorruptIndexError
+	if !errors.Is(err, ErrCorruptIndex) || !errors.As(err, &corrupt) {
+		t.Errorf("TagSuggestion error = %v, want ErrCorruptIndex", err)
+	}
+	if _, err := s.Query("title"); !errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("Query error = %v, want ErrCorruptIndex", err)
+	}
+}
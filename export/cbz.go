@@ -0,0 +1,47 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// CBZ streams pages of gallery into w as a cbz archive with ComicInfo.xml.
+// Pages are stored without compression since they are already compressed images.
+func CBZ(ctx context.Context, client *hitomi.Client, g *hitomi.Gallery, w io.Writer, opts *Options) error {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	modified := g.Published
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	archive := zip.NewWriter(w)
+	info, err := NewComicInfo(g).Marshal()
+	if err != nil {
+		return err
+	}
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: "ComicInfo.xml", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(info); err != nil {
+		return err
+	}
+
+	for i := range g.Files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: pageName(g, i), Method: zip.Store, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if err := writePage(ctx, client, g, i, f); err != nil {
+			return err
+		}
+		opts.progress(i+1, len(g.Files))
+	}
+	return archive.Close()
+}
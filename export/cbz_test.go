@@ -0,0 +1,73 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCBZ(t *testing.T) {
+	g := testGallery(t)
+	buf := new(bytes.Buffer)
+	var progress int
+	if err := CBZ(context.Background(), newTestClient(t), g, buf, DefaultOptions().WithProgress(func(done, total int) {
+		progress = done
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if progress != 3 {
+		t.Errorf("progress = %d", progress)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ComicInfo.xml", "001.webp", "002.webp", "003.webp"}
+	if len(archive.File) != len(want) {
+		t.Fatalf("got %d files, want %d", len(archive.File), len(want))
+	}
+	for i, f := range archive.File {
+		if f.Name != want[i] {
+			t.Errorf("file %d = %s, want %s", i, f.Name, want[i])
+		}
+		if i == 0 {
+			continue
+		}
+		r, _ := f.Open()
+		content, _ := io.ReadAll(r)
+		if string(content) != g.Files[i-1].Hash {
+			t.Errorf("page %s has content %q", f.Name, content)
+		}
+	}
+
+	r, _ := archive.File[0].Open()
+	content, _ := io.ReadAll(r)
+	var info ComicInfo
+	if err := xml.Unmarshal(content, &info); err != nil {
+		t.Fatal(err)
+	}
+	// readers show Summary as the synopsis, which the Japanese title is not
+	if strings.Contains(string(content), "Summary") {
+		t.Errorf("ComicInfo has Summary: %s", content)
+	}
+	if info.Title != "Sample & Title" || info.Writer != "some artist" || info.Penciller != "some artist" {
+		t.Errorf("title and creators = %q, %q, %q", info.Title, info.Writer, info.Penciller)
+	}
+	if info.Series != "original" || info.Characters != "someone" || info.Teams != "some group" {
+		t.Errorf("series, characters, teams = %q, %q, %q", info.Series, info.Characters, info.Teams)
+	}
+	if info.Tags != "female:glasses, full color" || info.LanguageISO != "ko" || info.Manga != "YesAndRightToLeft" {
+		t.Errorf("tags, language, manga = %q, %q, %q", info.Tags, info.LanguageISO, info.Manga)
+	}
+	if info.Year != 2023 || info.Month != 10 || info.Day != 10 || info.PageCount != 3 {
+		t.Errorf("date, page count = %d-%d-%d, %d", info.Year, info.Month, info.Day, info.PageCount)
+	}
+	if len(info.Pages) != 3 || info.Pages[0].Type != "FrontCover" || info.Pages[0].ImageWidth != 1000 || !info.Pages[2].DoublePage {
+		t.Errorf("pages = %+v", info.Pages)
+	}
+}
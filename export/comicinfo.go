@@ -0,0 +1,106 @@
+package export
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// ComicInfo is ComicInfo.xml of ComicRack schema 2.0, read by Komga and Kavita.
+type ComicInfo struct {
+	XMLName     xml.Name        `xml:"ComicInfo"`
+	XMLNSXSI    string          `xml:"xmlns:xsi,attr"`
+	XMLNSXSD    string          `xml:"xmlns:xsd,attr"`
+	Title       string          `xml:"Title,omitempty"`
+	Series      string          `xml:"Series,omitempty"`
+	Year        int             `xml:"Year,omitempty"`
+	Month       int             `xml:"Month,omitempty"`
+	Day         int             `xml:"Day,omitempty"`
+	Writer      string          `xml:"Writer,omitempty"`
+	Penciller   string          `xml:"Penciller,omitempty"`
+	Genre       string          `xml:"Genre,omitempty"`
+	Tags        string          `xml:"Tags,omitempty"`
+	Web         string          `xml:"Web,omitempty"`
+	PageCount   int             `xml:"PageCount"`
+	LanguageISO string          `xml:"LanguageISO,omitempty"`
+	Characters  string          `xml:"Characters,omitempty"`
+	Teams       string          `xml:"Teams,omitempty"`
+	Manga       string          `xml:"Manga,omitempty"`
+	AgeRating   string          `xml:"AgeRating,omitempty"`
+	Pages       []ComicInfoPage `xml:"Pages>Page"`
+}
+
+// ComicInfoPage is a page of ComicInfo.
+type ComicInfoPage struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	DoublePage  bool   `xml:"DoublePage,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr,omitempty"`
+	ImageHeight int    `xml:"ImageHeight,attr,omitempty"`
+}
+
+// NewComicInfo returns ComicInfo of gallery.
+// Artists are written as both Writer and Penciller, parodies as Series and groups as Teams.
+// The Japanese title is left out, since no field of the schema is meant for an alternative title of a one-shot.
+func NewComicInfo(g *hitomi.Gallery) *ComicInfo {
+	info := &ComicInfo{
+		XMLNSXSI:    "http://www.w3.org/2001/XMLSchema-instance",
+		XMLNSXSD:    "http://www.w3.org/2001/XMLSchema",
+		Title:       g.Title,
+		Writer:      strings.Join(artists(g), ", "),
+		Penciller:   strings.Join(artists(g), ", "),
+		Genre:       g.Type.String(),
+		Tags:        strings.Join(tagNames(g), ", "),
+		PageCount:   len(g.Files),
+		LanguageISO: languageCode(g.Language),
+		Manga:       "No",
+		AgeRating:   "Adults Only 18+",
+	}
+	if !g.Published.IsZero() {
+		info.Year, info.Month, info.Day = g.Published.Year(), int(g.Published.Month()), g.Published.Day()
+	}
+	if g.GalleryUrl != "" {
+		info.Web = "https://hitomi.la" + g.GalleryUrl
+	}
+	if rightToLeft(g) {
+		info.Manga = "YesAndRightToLeft"
+	}
+
+	var series, characters, groups []string
+	for _, p := range g.Parodies {
+		series = append(series, p.Parody)
+	}
+	for _, c := range g.Characters {
+		characters = append(characters, c.Character)
+	}
+	for _, gr := range g.Groups {
+		groups = append(groups, gr.Group)
+	}
+	info.Series = strings.Join(series, ", ")
+	info.Characters = strings.Join(characters, ", ")
+	info.Teams = strings.Join(groups, ", ")
+
+	for i, file := range g.Files {
+		page := ComicInfoPage{
+			Image:       i,
+			DoublePage:  file.Width > file.Height,
+			ImageWidth:  file.Width,
+			ImageHeight: file.Height,
+		}
+		if i == 0 {
+			page.Type = "FrontCover"
+		}
+		info.Pages = append(info.Pages, page)
+	}
+	return info
+}
+
+// Marshal returns ComicInfo.xml content.
+func (c *ComicInfo) Marshal() ([]byte, error) {
+	content, err := xml.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// EPUB streams pages of gallery into w as an EPUB 3 fixed-layout book.
+// The first page is used as the cover, and pages progress from right to left for manga.
+// Pages are converted to JPEG, since webp is not an EPUB core media type and e-ink readers do not render it.
+// Single pages and spreads are placed alone so that readers do not merge them with the next page.
+func EPUB(ctx context.Context, client *hitomi.Client, g *hitomi.Gallery, w io.Writer, opts *Options) error {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if len(g.Files) == 0 {
+		return fmt.Errorf("gallery %s has no pages", g.Id)
+	}
+	modified := g.Published.UTC()
+	if g.Published.IsZero() {
+		modified = time.Now().UTC()
+	}
+
+	archive := zip.NewWriter(w)
+	// mimetype must be the first file, stored without compression
+	files := []struct {
+		name    string
+		method  uint16
+		content string
+	}{
+		{"mimetype", zip.Store, "application/epub+zip"},
+		{"META-INF/container.xml", zip.Deflate, epubContainer},
+		{"OEBPS/content.opf", zip.Deflate, epubPackage(g, modified)},
+		{"OEBPS/nav.xhtml", zip.Deflate, epubNav(g)},
+	}
+	for i, file := range g.Files {
+		files = append(files, struct {
+			name    string
+			method  uint16
+			content string
+		}{"OEBPS/" + epubPageName(g, i), zip.Deflate, epubPage(g, i, file.Width, file.Height)})
+	}
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: file.method, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, file.content); err != nil {
+			return err
+		}
+	}
+
+	for i := range g.Files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: "OEBPS/images/" + epubImageName(g, i), Method: zip.Store, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if err := writeJPEGPage(ctx, client, g, i, f); err != nil {
+			return err
+		}
+		opts.progress(i+1, len(g.Files))
+	}
+	return archive.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// escapeXML escapes s for xml text and attribute values.
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func epubPageName(g *hitomi.Gallery, i int) string {
+	return "pages/" + strings.TrimSuffix(pageName(g, i), ".webp") + ".xhtml"
+}
+
+func epubImageName(g *hitomi.Gallery, i int) string {
+	return strings.TrimSuffix(pageName(g, i), ".webp") + ".jpg"
+}
+
+// epubJPEGQuality is the quality of pages converted to JPEG.
+const epubJPEGQuality = 90
+
+// writeJPEGPage writes i-th page of gallery into w as JPEG, copying JPEG pages as they are.
+func writeJPEGPage(ctx context.Context, client *hitomi.Client, g *hitomi.Gallery, i int, w io.Writer) error {
+	buf := new(bytes.Buffer)
+	if err := writePage(ctx, client, g, i, buf); err != nil {
+		return err
+	}
+	img, format, err := image.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return fmt.Errorf("page %d: unsupported image: %w", i+1, err)
+	}
+	if format == "jpeg" {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	// JPEG has no alpha, so transparent pixels are composed over white, as readers show them
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: epubJPEGQuality})
+}
+
+// epubSpreads returns page-spread property of each page.
+// The cover, single pages and landscape pages are centered, and the others are paired in reading order.
+func epubSpreads(g *hitomi.Gallery) []string {
+	first, second := "page-spread-left", "page-spread-right"
+	if rightToLeft(g) {
+		first, second = second, first
+	}
+	spreads := make([]string, len(g.Files))
+	next := first
+	for i, file := range g.Files {
+		if i == 0 || file.Single || file.Width > file.Height {
+			spreads[i] = "rendition:page-spread-center"
+			next = first
+			continue
+		}
+		spreads[i] = next
+		if next == first {
+			next = second
+		} else {
+			next = first
+		}
+	}
+	return spreads
+}
+
+func epubPackage(g *hitomi.Gallery, modified time.Time) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&b, "    <dc:identifier id=\"id\">urn:hitomi:%s</dc:identifier>\n", escapeXML(g.Id))
+	fmt.Fprintf(&b, "    <dc:title>%s</dc:title>\n", escapeXML(g.Title))
+	language := languageCode(g.Language)
+	if language == "" {
+		language = "und"
+	}
+	fmt.Fprintf(&b, "    <dc:language>%s</dc:language>\n", language)
+	for _, artist := range artists(g) {
+		fmt.Fprintf(&b, "    <dc:creator>%s</dc:creator>\n", escapeXML(artist))
+	}
+	for _, tag := range tagNames(g) {
+		fmt.Fprintf(&b, "    <dc:subject>%s</dc:subject>\n", escapeXML(tag))
+	}
+	if !g.Published.IsZero() {
+		fmt.Fprintf(&b, "    <dc:date>%s</dc:date>\n", g.Published.UTC().Format(time.RFC3339))
+	}
+	if g.GalleryUrl != "" {
+		fmt.Fprintf(&b, "    <dc:source>%s</dc:source>\n", escapeXML("https://hitomi.la"+g.GalleryUrl))
+	}
+	fmt.Fprintf(&b, "    <meta property=\"dcterms:modified\">%s</meta>\n", modified.Format("2006-01-02T15:04:05Z"))
+	b.WriteString(`    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:spread">landscape</meta>
+    <meta property="rendition:orientation">auto</meta>
+    <meta name="cover" content="image-1"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+`)
+	for i := range g.Files {
+		properties := ""
+		if i == 0 {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&b, "    <item id=\"page-%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, epubPageName(g, i))
+		fmt.Fprintf(&b, "    <item id=\"image-%d\" href=\"images/%s\" media-type=\"image/jpeg\"%s/>\n", i+1, epubImageName(g, i), properties)
+	}
+	direction := "ltr"
+	if rightToLeft(g) {
+		direction = "rtl"
+	}
+	b.WriteString("  </manifest>\n")
+	fmt.Fprintf(&b, "  <spine page-progression-direction=\"%s\">\n", direction)
+	for i, spread := range epubSpreads(g) {
+		fmt.Fprintf(&b, "    <itemref idref=\"page-%d\" properties=\"%s\"/>\n", i+1, spread)
+	}
+	b.WriteString("  </spine>\n</package>\n")
+	return b.String()
+}
+
+func epubNav(g *hitomi.Gallery) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%[1]s</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <ol><li><a href="%[2]s">%[1]s</a></li></ol>
+  </nav>
+</body>
+</html>
+`, escapeXML(g.Title), epubPageName(g, 0))
+}
+
+func epubPage(g *hitomi.Gallery, i, width, height int) string {
+	if width <= 0 || height <= 0 {
+		// hitomi does not know dimensions of some old galleries
+		width, height = 1000, 1414
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+  <title>%d</title>
+  <meta name="viewport" content="width=%d, height=%d"/>
+  <style>html, body { margin: 0; padding: 0; } img { display: block; width: %dpx; height: %dpx; }</style>
+</head>
+<body><img src="../images/%s" alt="%d"/></body>
+</html>
+`, i+1, width, height, width, height, epubImageName(g, i), i+1)
+}
@@ -0,0 +1,100 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEPUB(t *testing.T) {
+	g := testGallery(t)
+	webpPage, err := os.ReadFile("testdata/page.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpegPage := new(bytes.Buffer)
+	_ = jpeg.Encode(jpegPage, image.NewGray(image.Rect(0, 0, 10, 10)), nil)
+	client := newTestClientWith(t, func(hash string) string {
+		if hash == g.Files[0].Hash {
+			return jpegPage.String()
+		}
+		return string(webpPage)
+	})
+	buf := new(bytes.Buffer)
+	if err := EPUB(context.Background(), client, g, buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := archive.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Errorf("first file is %s with method %d, want stored mimetype", f.Name, f.Method)
+	}
+
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		content, _ := io.ReadAll(r)
+		files[f.Name] = string(content)
+		if strings.HasSuffix(f.Name, ".xhtml") || strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".xml") {
+			if err := xml.Unmarshal(content, new(struct{})); err != nil {
+				t.Errorf("%s is not well-formed: %v", f.Name, err)
+			}
+		}
+	}
+	if files["OEBPS/images/001.jpg"] != jpegPage.String() {
+		t.Error("jpeg page is not stored as it is")
+	}
+	if config, format, err := image.DecodeConfig(strings.NewReader(files["OEBPS/images/003.jpg"])); err != nil || format != "jpeg" || config.Width != 75 {
+		t.Errorf("webp page is not converted to jpeg: %s, %v", format, err)
+	}
+
+	opf := files["OEBPS/content.opf"]
+	for _, want := range []string{
+		`<dc:title>Sample &amp; Title</dc:title>`,
+		`<dc:language>ko</dc:language>`,
+		`<dc:creator>some artist</dc:creator>`,
+		`<dc:subject>female:glasses</dc:subject>`,
+		`<meta property="rendition:layout">pre-paginated</meta>`,
+		`href="images/001.jpg" media-type="image/jpeg" properties="cover-image"`,
+		`<spine page-progression-direction="rtl">`,
+		`<itemref idref="page-1" properties="rendition:page-spread-center"/>`,
+		`<itemref idref="page-2" properties="rendition:page-spread-center"/>`,
+		`<itemref idref="page-3" properties="rendition:page-spread-center"/>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf does not contain %s", want)
+		}
+	}
+	if !strings.Contains(files["OEBPS/pages/003.xhtml"], `content="width=2000, height=1400"`) {
+		t.Errorf("page 3 viewport is not sized from file: %s", files["OEBPS/pages/003.xhtml"])
+	}
+}
+
+func TestEPUBSpreads(t *testing.T) {
+	g := testGallery(t)
+	g.Files = append(g.Files, g.Files[0], g.Files[0], g.Files[0])
+	g.Files[1].Single = false
+	want := []string{
+		"rendition:page-spread-center",
+		"page-spread-right",
+		"rendition:page-spread-center",
+		"page-spread-right",
+		"page-spread-left",
+		"page-spread-right",
+	}
+	got := epubSpreads(g)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("page %d spread = %s, want %s", i+1, got[i], want[i])
+		}
+	}
+}
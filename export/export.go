@@ -0,0 +1,121 @@
+// Package export writes galleries into archive and document formats for readers.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// Options are options for exporters.
+type Options struct {
+	// Progress is called after each page is written, if it is set.
+	Progress func(done, total int)
+}
+
+func (o *Options) WithProgress(f func(done, total int)) *Options {
+	o.Progress = f
+	return o
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Progress: nil,
+	}
+}
+
+func (o *Options) progress(done, total int) {
+	if o.Progress != nil {
+		o.Progress(done, total)
+	}
+}
+
+// writePage streams i-th page of gallery into w.
+func writePage(ctx context.Context, client *hitomi.Client, g *hitomi.Gallery, i int, w io.Writer) error {
+	req := client.FileRequest(client.FileURL(g.Files[i].Hash), g.Id).WithContext(ctx)
+	if _, err := client.Download(req, w, nil); err != nil {
+		return fmt.Errorf("page %d: %w", i+1, err)
+	}
+	return nil
+}
+
+// pageName returns file name of i-th page, zero-padded to keep pages in order.
+func pageName(g *hitomi.Gallery, i int) string {
+	width := max(len(fmt.Sprint(len(g.Files))), 3)
+	return fmt.Sprintf("%0*d.webp", width, i+1)
+}
+
+// languageCodes maps hitomi language names to ISO 639-1 codes.
+var languageCodes = map[string]string{
+	"japanese":   "ja",
+	"english":    "en",
+	"korean":     "ko",
+	"chinese":    "zh",
+	"spanish":    "es",
+	"french":     "fr",
+	"german":     "de",
+	"russian":    "ru",
+	"italian":    "it",
+	"portuguese": "pt",
+	"thai":       "th",
+	"vietnamese": "vi",
+	"indonesian": "id",
+	"polish":     "pl",
+	"tagalog":    "tl",
+	"turkish":    "tr",
+	"ukrainian":  "uk",
+	"arabic":     "ar",
+	"dutch":      "nl",
+	"hungarian":  "hu",
+	"czech":      "cs",
+	"swedish":    "sv",
+	"finnish":    "fi",
+	"norwegian":  "no",
+	"danish":     "da",
+	"greek":      "el",
+	"hebrew":     "he",
+	"malay":      "ms",
+	"romanian":   "ro",
+}
+
+// languageCode returns ISO 639-1 code of hitomi language name, or empty string if unknown.
+func languageCode(name string) string {
+	return languageCodes[strings.ToLower(name)]
+}
+
+// rightToLeft reports whether pages of gallery are read from right to left,
+// which is true for manga and doujinshi, or japanese galleries of unknown type.
+func rightToLeft(g *hitomi.Gallery) bool {
+	switch g.Type {
+	case hitomi.GalleryTypeManga, hitomi.GalleryTypeDoujinshi:
+		return true
+	case hitomi.GalleryTypeUnknown:
+		return strings.EqualFold(g.Language, "japanese")
+	}
+	return false
+}
+
+// artists returns artist names of gallery.
+func artists(g *hitomi.Gallery) []string {
+	names := make([]string, len(g.Artists))
+	for i, a := range g.Artists {
+		names[i] = a.Artist
+	}
+	return names
+}
+
+// tagNames returns readable names of tags, with namespace except for plain tags.
+func tagNames(g *hitomi.Gallery) []string {
+	names := make([]string, len(g.Tags))
+	for i, t := range g.Tags {
+		if t.Namespace == hitomi.NamespaceTag {
+			names[i] = t.Name
+		} else {
+			names[i] = t.Namespace + ":" + t.Name
+		}
+	}
+	return names
+}
@@ -0,0 +1,54 @@
+package export
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+// newTestClient returns a client serving gg.js and pages whose content is their hash.
+func newTestClient(t *testing.T) *hitomi.Client {
+	return newTestClientWith(t, func(hash string) string { return hash })
+}
+
+// newTestClientWith returns a client serving gg.js and pages whose content is page(hash).
+func newTestClientWith(t *testing.T, page func(hash string) string) *hitomi.Client {
+	h := stub.New()
+	h.Handle(func(req *http.Request) *http.Response {
+		if path.Ext(req.URL.Path) != ".webp" {
+			return nil
+		}
+		return stub.Response(200, page(strings.TrimSuffix(path.Base(req.URL.Path), ".webp")))
+	})
+	client := hitomi.NewClient(hitomi.DefaultOptions().WithClient(h.Client()))
+	if err := client.UpdateScript(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// testGallery returns a gallery with three pages, the last of which is a spread.
+func testGallery(t *testing.T) *hitomi.Gallery {
+	g := new(hitomi.Gallery)
+	err := json.Unmarshal([]byte(`{
+		"Id": "123", "Title": "Sample & Title", "JapaneseTitle": "サンプル", "Language": "korean",
+		"Type": "doujinshi", "Published": "2023-10-10T13:19:00-05:00", "GalleryUrl": "/doujinshi/sample-123.html",
+		"Artists": [{"Artist": "some artist"}], "Groups": [{"Group": "some group"}],
+		"Parodies": [{"Parody": "original"}], "Characters": [{"Character": "someone"}],
+		"Tags": [{"Namespace": "female", "Name": "glasses"}, {"Namespace": "tag", "Name": "full color"}],
+		"Files": [
+			{"Hash": "`+strings.Repeat("a", 64)+`", "Name": "01.jpg", "Width": 1000, "Height": 1400},
+			{"Hash": "`+strings.Repeat("b", 64)+`", "Name": "02.jpg", "Width": 1000, "Height": 1400, "Single": true},
+			{"Hash": "`+strings.Repeat("c", 64)+`", "Name": "03.jpg", "Width": 2000, "Height": 1400}
+		]
+	}`), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
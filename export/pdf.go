@@ -0,0 +1,206 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/EINNN7/hitomi"
+	_ "golang.org/x/image/webp"
+)
+
+// pdfPointsPerPixel converts pixels to points, assuming 96 dpi images.
+const pdfPointsPerPixel = 0.75
+
+// PDF writes pages of gallery into w as a PDF document, one image per page.
+// Each page is sized from Files[].Width/Height, and document information is written from gallery.
+//
+// JPEG pages are embedded as they are. Other pages, including webp pages hitomi serves,
+// are decoded and embedded losslessly.
+func PDF(ctx context.Context, client *hitomi.Client, g *hitomi.Gallery, w io.Writer, opts *Options) error {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if len(g.Files) == 0 {
+		return fmt.Errorf("gallery %s has no pages", g.Id)
+	}
+	p := &pdfWriter{w: w}
+
+	// objects are numbered upfront: catalog, pages, info, then page, content and image of each page
+	pageObject := func(i int) int { return 4 + i*3 }
+	p.header()
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(g.Files))
+	for i := range g.Files {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObject(i))
+	}
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(g.Files)))
+	p.object(3, pdfInfo(g))
+
+	for i, file := range g.Files {
+		buf := new(bytes.Buffer)
+		if err := writePage(ctx, client, g, i, buf); err != nil {
+			return err
+		}
+		img, err := newPDFImage(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("page %d: %w", i+1, err)
+		}
+		width, height := file.Width, file.Height
+		if width <= 0 || height <= 0 {
+			width, height = img.width, img.height
+		}
+		pageWidth, pageHeight := float64(width)*pdfPointsPerPixel, float64(height)*pdfPointsPerPixel
+
+		page := pageObject(i)
+		p.object(page, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pdfNumber(pageWidth), pdfNumber(pageHeight), page+2, page+1))
+		p.stream(page+1, "", []byte(fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q", pdfNumber(pageWidth), pdfNumber(pageHeight))))
+		p.stream(page+2, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s",
+			img.width, img.height, img.colorSpace, img.filter), img.data)
+		if p.err != nil {
+			return p.err
+		}
+		opts.progress(i+1, len(g.Files))
+	}
+	p.trailer(4+len(g.Files)*3, 1, 3)
+	return p.err
+}
+
+// pdfWriter writes PDF objects, keeping their offsets for the cross-reference table.
+type pdfWriter struct {
+	w       io.Writer
+	offset  int
+	offsets map[int]int
+	err     error
+}
+
+func (p *pdfWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	n, err := io.WriteString(p.w, s)
+	p.offset += n
+	p.err = err
+}
+
+func (p *pdfWriter) header() {
+	p.offsets = map[int]int{}
+	// binary comment marks the file as binary for transfer programs
+	p.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+}
+
+func (p *pdfWriter) object(n int, content string) {
+	p.offsets[n] = p.offset
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", n, content))
+}
+
+func (p *pdfWriter) stream(n int, dict string, data []byte) {
+	p.offsets[n] = p.offset
+	p.write(fmt.Sprintf("%d 0 obj\n<< %s /Length %d >>\nstream\n", n, strings.TrimSpace(dict), len(data)))
+	p.write(string(data))
+	p.write("\nendstream\nendobj\n")
+}
+
+func (p *pdfWriter) trailer(size, root, info int) {
+	xref := p.offset
+	p.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", size))
+	for i := 1; i < size; i++ {
+		p.write(fmt.Sprintf("%010d 00000 n \n", p.offsets[i]))
+	}
+	p.write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, root, info, xref))
+}
+
+// pdfNumber formats a number without unnecessary fraction digits.
+func pdfNumber(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+}
+
+// pdfText encodes s as a PDF text string in UTF-16BE, which works for any language.
+func pdfText(s string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, v := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", v)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func pdfInfo(g *hitomi.Gallery) string {
+	info := []string{
+		"/Title " + pdfText(g.Title),
+		"/Author " + pdfText(strings.Join(artists(g), ", ")),
+		"/Keywords " + pdfText(strings.Join(tagNames(g), ", ")),
+		"/Creator " + pdfText("github.com/EINNN7/hitomi"),
+	}
+	if g.GalleryUrl != "" {
+		info = append(info, "/Subject "+pdfText("https://hitomi.la"+g.GalleryUrl))
+	}
+	if !g.Published.IsZero() {
+		info = append(info, fmt.Sprintf("/CreationDate (D:%s)", g.Published.UTC().Format("20060102150405Z")))
+	}
+	info = append(info, fmt.Sprintf("/ModDate (D:%s)", time.Now().UTC().Format("20060102150405Z")))
+	return "<< " + strings.Join(info, " ") + " >>"
+}
+
+// pdfImage is an image XObject.
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+}
+
+// newPDFImage returns image XObject of data, embedding JPEG without recompression.
+func newPDFImage(data []byte) (*pdfImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if format == "jpeg" {
+		colorSpace := "/DeviceRGB"
+		switch config.ColorModel {
+		case color.GrayModel:
+			colorSpace = "/DeviceGray"
+		case color.CMYKModel:
+			// Adobe CMYK JPEGs are stored inverted
+			colorSpace = "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+		}
+		return &pdfImage{width: config.Width, height: config.Height, colorSpace: colorSpace, filter: "/DCTDecode", data: data}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	raw := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// transparent pixels are composed over white, as readers show them
+			r, g, b, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			raw = append(raw, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+	}
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &pdfImage{width: bounds.Dx(), height: bounds.Dy(), colorSpace: "/DeviceRGB", filter: "/FlateDecode", data: compressed.Bytes()}, nil
+}
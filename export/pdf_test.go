@@ -0,0 +1,99 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDF(t *testing.T) {
+	g := testGallery(t)
+	img := image.NewRGBA(image.Rect(0, 0, 20, 28))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(1, 1, color.RGBA{R: 0xff, A: 0xff})
+	jpegPage, pngPage := new(bytes.Buffer), new(bytes.Buffer)
+	_ = jpeg.Encode(jpegPage, img, nil)
+	_ = png.Encode(pngPage, img)
+	client := newTestClientWith(t, func(hash string) string {
+		if hash == g.Files[0].Hash {
+			return jpegPage.String()
+		}
+		return pngPage.String()
+	})
+	g.Files[2].Width, g.Files[2].Height = 0, 0
+
+	buf := new(bytes.Buffer)
+	if err := PDF(context.Background(), client, g, buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4\n") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatalf("invalid pdf header or trailer")
+	}
+
+	// every object in the cross-reference table must be at its offset
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdf)
+	xref, _ := strconv.Atoi(m[1])
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[xref:], -1)
+	if len(entries) != 3+3*len(g.Files) {
+		t.Fatalf("got %d xref entries", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(pdf[offset:], want) {
+			t.Errorf("object %d is not at offset %d", i+1, offset)
+		}
+	}
+
+	for _, want := range []string{
+		"/Count 3",
+		"/MediaBox [0 0 750 1050]",
+		"/MediaBox [0 0 15 21]",
+		"/Width 20 /Height 28 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length " + strconv.Itoa(jpegPage.Len()),
+		"/Filter /FlateDecode",
+		"/Title " + pdfText("Sample & Title"),
+		"/Author " + pdfText("some artist"),
+		"/Keywords " + pdfText("female:glasses, full color"),
+		"/CreationDate (D:20231010181900Z)",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("pdf does not contain %s", want)
+		}
+	}
+	if !strings.Contains(pdf, jpegPage.String()) {
+		t.Error("jpeg page is not embedded as it is")
+	}
+
+	webpPage, err := os.ReadFile("testdata/page.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := PDF(context.Background(), newTestClientWith(t, func(string) string { return string(webpPage) }), g, buf, nil); err != nil {
+		t.Fatalf("PDF with webp pages: %v", err)
+	}
+	if !strings.Contains(buf.String(), "/Width 75 /Height 100 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode") {
+		t.Error("webp page is not embedded")
+	}
+
+	if err := PDF(context.Background(), newTestClient(t), g, new(bytes.Buffer), nil); err == nil {
+		t.Error("PDF with undecodable pages succeeded")
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	if got := pdfText("a한"); got != "<FEFF0061D55C>" {
+		t.Errorf("pdfText = %s", got)
+	}
+}
@@ -0,0 +1,283 @@
+package hitomi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Filter is a content policy deciding which galleries are allowed.
+//
+// A gallery is excluded if it is blocked by hitomi, or it matches any Blocked rule,
+// or it matches none of a non-empty Allowed rule. Blocked rules win over Allowed rules.
+// Tags in BlockedTags and AllowedTags may be of any namespace of QueryNamespaces,
+// so "series:x" or "group:y" can be blocked as well.
+type Filter struct {
+	BlockedTags      []Tag
+	AllowedTags      []Tag
+	BlockedArtists   []string
+	AllowedArtists   []string
+	BlockedTypes     []GalleryType
+	AllowedTypes     []GalleryType
+	BlockedLanguages []string
+	AllowedLanguages []string
+}
+
+// ErrExcluded is returned for galleries excluded by Filter.
+var ErrExcluded = errors.New("excluded by filter")
+
+// Exclusion explains which rule of Filter excluded a gallery.
+type Exclusion struct {
+	// Rule is the name of the rule, like "BlockedTags", "Blocked" for galleries blocked by hitomi,
+	// or "Missing" for galleries without metadata.
+	Rule string
+	// Value is the value which matched a Blocked rule, empty for Allowed rules.
+	Value string
+}
+
+func (e *Exclusion) Error() string {
+	switch {
+	case e.Rule == "Blocked":
+		return "excluded by filter: blocked by hitomi"
+	case e.Rule == "Missing":
+		return "excluded by filter: no metadata"
+	case e.Value == "":
+		return fmt.Sprintf("excluded by filter: not in %s", e.Rule)
+	}
+	return fmt.Sprintf("excluded by filter: %s in %s", e.Value, e.Rule)
+}
+
+func (e *Exclusion) Is(target error) bool {
+	return target == ErrExcluded
+}
+
+// Check returns why g is excluded, or nil if it is allowed.
+// A nil filter only excludes galleries blocked by hitomi. A nil gallery is always excluded, since it cannot be checked.
+func (f *Filter) Check(g *Gallery) *Exclusion {
+	if g == nil {
+		return &Exclusion{Rule: "Missing"}
+	}
+	if g.Blocked {
+		return &Exclusion{Rule: "Blocked"}
+	}
+	if f == nil {
+		return nil
+	}
+	tags := g.QueryTags()
+	language := strings.ToLower(g.Language)
+
+	if containsFold(f.BlockedLanguages, language) {
+		return &Exclusion{Rule: "BlockedLanguages", Value: language}
+	}
+	if slices.Contains(f.BlockedTypes, g.Type) {
+		return &Exclusion{Rule: "BlockedTypes", Value: g.Type.String()}
+	}
+	if artist, ok := matchArtist(g, f.BlockedArtists); ok {
+		return &Exclusion{Rule: "BlockedArtists", Value: artist}
+	}
+	for _, tag := range tags {
+		if slices.Contains(f.BlockedTags, tag) {
+			return &Exclusion{Rule: "BlockedTags", Value: tag.String()}
+		}
+	}
+
+	if len(f.AllowedLanguages) > 0 && !containsFold(f.AllowedLanguages, language) {
+		return &Exclusion{Rule: "AllowedLanguages"}
+	}
+	if len(f.AllowedTypes) > 0 && !slices.Contains(f.AllowedTypes, g.Type) {
+		return &Exclusion{Rule: "AllowedTypes"}
+	}
+	if _, ok := matchArtist(g, f.AllowedArtists); len(f.AllowedArtists) > 0 && !ok {
+		return &Exclusion{Rule: "AllowedArtists"}
+	}
+	if len(f.AllowedTags) > 0 && !slices.ContainsFunc(tags, func(tag Tag) bool {
+		return slices.Contains(f.AllowedTags, tag)
+	}) {
+		return &Exclusion{Rule: "AllowedTags"}
+	}
+	return nil
+}
+
+// Allow reports whether g is allowed.
+func (f *Filter) Allow(g *Gallery) bool {
+	return f.Check(g) == nil
+}
+
+// Apply returns allowed galleries, keeping their order.
+func (f *Filter) Apply(galleries []*Gallery) []*Gallery {
+	var result []*Gallery
+	for _, g := range galleries {
+		if f.Allow(g) {
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// Query returns query narrowed down by rules of the filter, so that searches skip most excluded galleries
+// before their metadata is fetched. Galleries blocked by hitomi and names which cannot be written in queries
+// are not handled, so results must still be checked by Check.
+func (f *Filter) Query(query string) string {
+	if f == nil {
+		return query
+	}
+	// embed the parsed query rather than its text, so that it cannot close the group and escape the rules
+	expr, err := ParseQuery(query)
+	if err != nil {
+		// searching it reports the error
+		return query
+	}
+	var parts []string
+	if expr != nil {
+		parts = append(parts, "("+expr.String()+")")
+	}
+	for _, language := range f.BlockedLanguages {
+		parts = appendTerm(parts, "-", Tag{Namespace: NamespaceLanguage, Name: language})
+	}
+	for _, t := range f.BlockedTypes {
+		parts = appendTerm(parts, "-", t.Tag())
+	}
+	for _, artist := range f.BlockedArtists {
+		parts = appendTerm(parts, "-", Tag{Namespace: NamespaceArtist, Name: artist})
+	}
+	for _, tag := range f.BlockedTags {
+		parts = appendTerm(parts, "-", tag)
+	}
+
+	var languages, types, artists []Tag
+	for _, language := range f.AllowedLanguages {
+		languages = append(languages, Tag{Namespace: NamespaceLanguage, Name: language})
+	}
+	for _, t := range f.AllowedTypes {
+		types = append(types, t.Tag())
+	}
+	for _, artist := range f.AllowedArtists {
+		artists = append(artists, Tag{Namespace: NamespaceArtist, Name: artist})
+	}
+	for _, allowed := range [][]Tag{languages, types, artists, f.AllowedTags} {
+		var terms []string
+		for _, tag := range allowed {
+			terms = appendTerm(terms, "", tag)
+		}
+		// an allowlist is only usable if every term can be written
+		if len(terms) > 0 && len(terms) == len(allowed) {
+			parts = append(parts, "("+strings.Join(terms, " | ")+")")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// appendTerm appends tag as a query term with prefix, unless tag cannot be written in queries.
+func appendTerm(terms []string, prefix string, tag Tag) []string {
+	name := strings.ToLower(strings.TrimSpace(tag.Name))
+	if name == "" || !slices.Contains(QueryNamespaces, tag.Namespace) || strings.Contains(name, `"`) {
+		return terms
+	}
+	return append(terms, prefix+tag.Namespace+`:"`+name+`"`)
+}
+
+// matchArtist returns the first artist of g in artists.
+func matchArtist(g *Gallery, artists []string) (string, bool) {
+	for _, a := range g.Artists {
+		if containsFold(artists, a.Artist) {
+			return strings.ToLower(a.Artist), true
+		}
+	}
+	return "", false
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
+
+// filterJSON is the JSON form of Filter, with tags written as "namespace:name".
+type filterJSON struct {
+	BlockedTags      []string      `json:"blocked_tags,omitempty"`
+	AllowedTags      []string      `json:"allowed_tags,omitempty"`
+	BlockedArtists   []string      `json:"blocked_artists,omitempty"`
+	AllowedArtists   []string      `json:"allowed_artists,omitempty"`
+	BlockedTypes     []GalleryType `json:"blocked_types,omitempty"`
+	AllowedTypes     []GalleryType `json:"allowed_types,omitempty"`
+	BlockedLanguages []string      `json:"blocked_languages,omitempty"`
+	AllowedLanguages []string      `json:"allowed_languages,omitempty"`
+}
+
+func (f *Filter) MarshalJSON() ([]byte, error) {
+	v := filterJSON{
+		BlockedArtists:   f.BlockedArtists,
+		AllowedArtists:   f.AllowedArtists,
+		BlockedTypes:     f.BlockedTypes,
+		AllowedTypes:     f.AllowedTypes,
+		BlockedLanguages: f.BlockedLanguages,
+		AllowedLanguages: f.AllowedLanguages,
+	}
+	for _, tag := range f.BlockedTags {
+		v.BlockedTags = append(v.BlockedTags, tag.String())
+	}
+	for _, tag := range f.AllowedTags {
+		v.AllowedTags = append(v.AllowedTags, tag.String())
+	}
+	return json.Marshal(v)
+}
+
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	var v filterJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = Filter{
+		BlockedArtists:   v.BlockedArtists,
+		AllowedArtists:   v.AllowedArtists,
+		BlockedTypes:     v.BlockedTypes,
+		AllowedTypes:     v.AllowedTypes,
+		BlockedLanguages: v.BlockedLanguages,
+		AllowedLanguages: v.AllowedLanguages,
+	}
+	for _, t := range append(slices.Clone(v.BlockedTypes), v.AllowedTypes...) {
+		if t == GalleryTypeUnknown {
+			// unknown names would silently allow or block nothing, which is dangerous for a policy
+			return errors.New("invalid filter: unknown gallery type")
+		}
+	}
+	var err error
+	if f.BlockedTags, err = parseFilterTags(v.BlockedTags); err != nil {
+		return err
+	}
+	if f.AllowedTags, err = parseFilterTags(v.AllowedTags); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseFilterTags(list []string) ([]Tag, error) {
+	var tags []Tag
+	for _, s := range list {
+		tag, err := ParseTag(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		if tag.Name == "" {
+			return nil, fmt.Errorf("invalid filter: empty tag name: %s", s)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// LoadFilter reads filter from JSON file of path, like
+//
+//	{"blocked_tags": ["female:guro"], "blocked_types": ["anime"], "allowed_languages": ["korean", "english"]}
+func LoadFilter(path string) (*Filter, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := new(Filter)
+	if err := json.Unmarshal(content, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,149 @@
+package hitomi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// filterScripts are gallery scripts covering every rule of Filter.
+var filterScripts = map[int]string{
+	1: `{"id": 1, "type": "manga", "language": "korean", "artists": [{"artist": "Foo"}], "tags": [{"tag": "glasses", "female": "1"}]}`,
+	2: `{"id": 2, "type": "doujinshi", "language": "english", "artists": [{"artist": "bar"}], "tags": [{"tag": "guro", "female": "1"}]}`,
+	3: `{"id": 3, "type": "anime", "language": "japanese", "artists": [{"artist": "foo"}]}`,
+	4: `{"id": 4, "type": "manga", "language": "chinese", "artists": [{"artist": "baz"}], "parodys": [{"parody": "Some Series"}]}`,
+	5: `{"id": 5, "type": "manga", "language": "korean", "artists": [{"artist": "foo"}], "blocked": 1}`,
+}
+
+func TestFilter_Check(t *testing.T) {
+	_, galleries := scriptClient(t, filterScripts)
+	f := &Filter{
+		BlockedTags:      []Tag{{Namespace: NamespaceFemale, Name: "guro"}, {Namespace: NamespaceSeries, Name: "some series"}},
+		BlockedTypes:     []GalleryType{GalleryTypeAnime},
+		BlockedLanguages: []string{"Chinese"},
+		AllowedArtists:   []string{"FOO", "bar"},
+	}
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"1", ""},
+		{"2", "excluded by filter: female:guro in BlockedTags"},
+		{"3", "excluded by filter: anime in BlockedTypes"},
+		{"4", "excluded by filter: chinese in BlockedLanguages"},
+		{"5", "excluded by filter: blocked by hitomi"},
+	}
+	for _, tt := range tests {
+		exclusion := f.Check(galleries[tt.id])
+		var got string
+		if exclusion != nil {
+			got = exclusion.Error()
+			if !errors.Is(exclusion, ErrExcluded) {
+				t.Errorf("%s: exclusion is not ErrExcluded", tt.id)
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: Check = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	f = &Filter{AllowedLanguages: []string{"korean", "english"}}
+	if exclusion := f.Check(galleries["3"]); exclusion == nil || exclusion.Rule != "AllowedLanguages" {
+		t.Errorf("Check by allowlist = %v", exclusion)
+	}
+	if got := galleryIDs(f.Apply([]*Gallery{galleries["1"], galleries["2"], galleries["3"], galleries["5"]})); got != "1,2" {
+		t.Errorf("Apply = %s", got)
+	}
+
+	var nilFilter *Filter
+	if !nilFilter.Allow(galleries["2"]) || nilFilter.Allow(galleries["5"]) {
+		t.Error("nil filter should only exclude blocked galleries")
+	}
+	// entries without metadata cannot be checked
+	if exclusion := nilFilter.Check(nil); exclusion == nil || exclusion.Rule != "Missing" {
+		t.Errorf("Check(nil) = %v", exclusion)
+	}
+}
+
+func TestFilter_Query(t *testing.T) {
+	f := &Filter{
+		BlockedTags:      []Tag{{Namespace: NamespaceFemale, Name: "guro"}, {Namespace: "unknown", Name: "x"}},
+		BlockedTypes:     []GalleryType{GalleryTypeAnime},
+		BlockedArtists:   []string{"Some Artist"},
+		AllowedLanguages: []string{"korean", "english"},
+	}
+	got := f.Query("female:glasses")
+	want := `(female:glasses) -type:"anime" -artist:"some artist" -female:"guro" (language:"korean" | language:"english")`
+	if got != want {
+		t.Errorf("Query = %s, want %s", got, want)
+	}
+	if _, err := ParseQuery(got); err != nil {
+		t.Errorf("ParseQuery(%s): %v", got, err)
+	}
+	if got := f.Query(""); !strings.HasPrefix(got, `-type:"anime" `) {
+		t.Errorf("Query of empty query = %s", got)
+	}
+	// a query closing the group must not escape the rules
+	if got := f.Query("a) | (b"); got != "a) | (b" {
+		t.Errorf("Query of invalid query = %s", got)
+	}
+	if got := f.Query(`a | b`); !strings.HasPrefix(got, `(a | b) -type:"anime"`) {
+		t.Errorf("Query of or = %s", got)
+	}
+	var nilFilter *Filter
+	if got := nilFilter.Query("a"); got != "a" {
+		t.Errorf("nil filter Query = %s", got)
+	}
+}
+
+func TestFilter_JSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filter.json")
+	content := `{"blocked_tags": ["female:guro", "series:some series"], "blocked_types": ["anime"], "allowed_languages": ["korean"]}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Filter{
+		BlockedTags:      []Tag{{Namespace: NamespaceFemale, Name: "guro"}, {Namespace: NamespaceSeries, Name: "some series"}},
+		BlockedTypes:     []GalleryType{GalleryTypeAnime},
+		AllowedLanguages: []string{"korean"},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("LoadFilter = %+v, want %+v", f, want)
+	}
+
+	for _, invalid := range []string{`{"blocked_types": ["comic"]}`, `{"allowed_tags": ["female:"]}`} {
+		if err := os.WriteFile(path, []byte(invalid), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFilter(path); err == nil {
+			t.Errorf("LoadFilter(%s) should fail", invalid)
+		}
+	}
+}
+
+func TestClient_Galleries_Filter(t *testing.T) {
+	client, _ := scriptClient(t, filterScripts)
+	opts := DefaultBatchOptions().WithOrdered(true).WithFilter(&Filter{BlockedTypes: []GalleryType{GalleryTypeAnime}})
+	var allowed []int
+	for r := range client.Galleries(context.Background(), []int{1, 3, 5}, opts) {
+		if r.Err != nil {
+			if !errors.Is(r.Err, ErrExcluded) {
+				t.Errorf("%d: %v", r.Id, r.Err)
+			}
+			continue
+		}
+		allowed = append(allowed, r.Id)
+	}
+	if !reflect.DeepEqual(allowed, []int{1}) {
+		t.Errorf("allowed = %v", allowed)
+	}
+}
@@ -0,0 +1,88 @@
+package hitomi
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GalleryType is the type of gallery.
+type GalleryType int
+
+const (
+	GalleryTypeUnknown GalleryType = iota
+	GalleryTypeDoujinshi
+	GalleryTypeManga
+	GalleryTypeArtistCG
+	GalleryTypeGameCG
+	GalleryTypeImageSet
+	GalleryTypeAnime
+)
+
+var galleryTypeNames = map[GalleryType]string{
+	GalleryTypeUnknown:   "unknown",
+	GalleryTypeDoujinshi: "doujinshi",
+	GalleryTypeManga:     "manga",
+	GalleryTypeArtistCG:  "artistcg",
+	GalleryTypeGameCG:    "gamecg",
+	GalleryTypeImageSet:  "imageset",
+	GalleryTypeAnime:     "anime",
+}
+
+// ParseGalleryType parses type name used by hitomi.
+// It returns GalleryTypeUnknown for unknown names.
+func ParseGalleryType(s string) GalleryType {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for t, name := range galleryTypeNames {
+		if name == s {
+			return t
+		}
+	}
+	return GalleryTypeUnknown
+}
+
+func (t GalleryType) String() string {
+	if name, ok := galleryTypeNames[t]; ok {
+		return name
+	}
+	return galleryTypeNames[GalleryTypeUnknown]
+}
+
+// Tag returns the tag to search galleries of the type.
+func (t GalleryType) Tag() Tag {
+	return Tag{Namespace: NamespaceType, Name: t.String()}
+}
+
+func (t GalleryType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *GalleryType) UnmarshalText(text []byte) error {
+	*t = ParseGalleryType(string(text))
+	return nil
+}
+
+// dateLayouts are layouts of dates used by hitomi.
+// Timezone offset is usually written in hours only, like "2018-01-07 07:43:00-06".
+var dateLayouts = []string{
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02 15:04:05Z07:00",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate parses date used by hitomi.
+// Dates without timezone offset are treated as UTC.
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", s)
+}
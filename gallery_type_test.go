@@ -0,0 +1,61 @@
+package hitomi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGalleryType(t *testing.T) {
+	for typ, name := range galleryTypeNames {
+		if got := ParseGalleryType(name); got != typ {
+			t.Errorf("ParseGalleryType(%q) = %v, want %v", name, got, typ)
+		}
+	}
+	if got := ParseGalleryType("something"); got != GalleryTypeUnknown {
+		t.Errorf("ParseGalleryType(unknown) = %v", got)
+	}
+	if got := GalleryTypeArtistCG.Tag().NozomiPath(); got != "type/artistcg-all.nozomi" {
+		t.Errorf("Tag().NozomiPath() = %q", got)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	want := time.Date(2018, 1, 7, 13, 43, 0, 0, time.UTC)
+	for _, in := range []string{
+		"2018-01-07 07:43:00-06",
+		"2018-01-07 07:43:00-06:00",
+		"2018-01-07 07:43:00-0600",
+		"2018-01-07T07:43:00-06:00",
+		"2018-01-07 13:43:00",
+	} {
+		got, err := parseDate(in)
+		if err != nil {
+			t.Fatalf("parseDate(%q): %v", in, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseDate(%q) = %v, want %v", in, got, want)
+		}
+	}
+	if _, err := parseDate("yesterday"); err == nil {
+		t.Error("parseDate(invalid) succeeded")
+	}
+}
+
+func TestSortAndFilterGalleries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+	galleries := []*Gallery{
+		{Id: "1", Published: day(2), Type: GalleryTypeManga},
+		{Id: "2", Published: day(3), Type: GalleryTypeDoujinshi},
+		{Id: "3", Published: day(1), Type: GalleryTypeDoujinshi},
+	}
+	SortByPublished(galleries, true)
+	if galleries[0].Id != "2" || galleries[2].Id != "3" {
+		t.Errorf("SortByPublished: got %s, %s, %s", galleries[0].Id, galleries[1].Id, galleries[2].Id)
+	}
+	if got := FilterByType(galleries, GalleryTypeDoujinshi); len(got) != 2 {
+		t.Errorf("FilterByType: got %d galleries", len(got))
+	}
+	if got := FilterByPublished(galleries, day(2), time.Time{}); len(got) != 2 {
+		t.Errorf("FilterByPublished: got %d galleries", len(got))
+	}
+}
@@ -0,0 +1,126 @@
+package hitomi
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GalleryBlock is a lightweight summary of gallery used by listing pages.
+// It is much cheaper to fetch than Gallery, but lacks files and some metadata.
+type GalleryBlock struct {
+	Id         string
+	Title      string
+	GalleryUrl string
+	Artists    []string
+	Groups     []string
+	Series     []string
+	Characters []string
+	Type       GalleryType
+	Language   string
+	Tags       []Tag
+	// ThumbnailHashes are hashes of thumbnail images, usually first two pages.
+	ThumbnailHashes []string
+	Date            string
+	Published       time.Time
+}
+
+var (
+	matchBlockTitle = regexp.MustCompile(`(?s)<h1[^>]*>\s*<a href="([^"]*)"[^>]*>(.*?)</a>`)
+	matchBlockLink  = regexp.MustCompile(`(?s)<a href="([^"]*)"[^>]*>(.*?)</a>`)
+	matchBlockId    = regexp.MustCompile(`-(\d+)\.html$`)
+	matchBlockDate  = regexp.MustCompile(`(?s)<p class="date"(?:\s+data-posted="([^"]*)")?[^>]*>(.*?)</p>`)
+	matchBlockHash  = regexp.MustCompile(`/([0-9a-f]{64})\.[a-z]+`)
+	matchHTMLTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// GalleryBlock returns gallery block, the listing card of gallery.
+func (c *Client) GalleryBlock(id string) (*GalleryBlock, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://ltn.hitomi.la/galleryblock/%s.html", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("failed to get gallery block: %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	block, err := parseGalleryBlock(string(content))
+	if err != nil {
+		return nil, err
+	}
+	if block.Id == "" {
+		block.Id = id
+	}
+	return block, nil
+}
+
+func parseGalleryBlock(content string) (*GalleryBlock, error) {
+	block := new(GalleryBlock)
+	title := matchBlockTitle.FindStringSubmatch(content)
+	if title == nil {
+		return nil, fmt.Errorf("invalid gallery block: title not found")
+	}
+	block.GalleryUrl = title[1]
+	block.Title = blockText(title[2])
+	if m := matchBlockId.FindStringSubmatch(block.GalleryUrl); m != nil {
+		block.Id = m[1]
+	}
+
+	for _, link := range matchBlockLink.FindAllStringSubmatch(content, -1) {
+		tag, ok := parseTagURL(link[1])
+		if !ok {
+			continue
+		}
+		switch tag.Namespace {
+		case NamespaceArtist:
+			block.Artists = append(block.Artists, tag.Name)
+		case NamespaceGroup:
+			block.Groups = append(block.Groups, tag.Name)
+		case NamespaceSeries:
+			block.Series = append(block.Series, tag.Name)
+		case NamespaceCharacter:
+			block.Characters = append(block.Characters, tag.Name)
+		case NamespaceType:
+			block.Type = ParseGalleryType(tag.Name)
+		case NamespaceLanguage:
+			block.Language = tag.Name
+		case NamespaceTag, NamespaceFemale, NamespaceMale:
+			block.Tags = append(block.Tags, tag)
+		}
+	}
+
+	for _, m := range matchBlockHash.FindAllStringSubmatch(content, -1) {
+		if !slices.Contains(block.ThumbnailHashes, m[1]) {
+			block.ThumbnailHashes = append(block.ThumbnailHashes, m[1])
+		}
+	}
+
+	if m := matchBlockDate.FindStringSubmatch(content); m != nil {
+		block.Date = m[1]
+		if block.Date == "" {
+			block.Date = blockText(m[2])
+		}
+		block.Published, _ = parseDate(block.Date)
+	}
+	return block, nil
+}
+
+// blockText returns text content of html fragment.
+func blockText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(matchHTMLTag.ReplaceAllString(s, "")))
+}
@@ -0,0 +1,76 @@
+package hitomi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+const sampleGalleryBlock = `<div class="dj">
+<a href="/doujinshi/sample-title-한국어-1234567.html"><div class="dj-img-cont"><div class="dj-img1"><picture><source type="image/avif" data-srcset="//tn.hitomi.la/avifsmallbigtn/4/5a/2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881.avif 2x"><img data-src="//tn.hitomi.la/webpsmallbigtn/4/5a/2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881.webp"></picture></div><div class="dj-img2"><picture><img data-src="//tn.hitomi.la/webpsmallbigtn/b/c3/00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff.webp"></picture></div></div></a>
+<h1 class="lillie"><a href="/doujinshi/sample-title-한국어-1234567.html">Sample &amp; Title</a></h1>
+<div class="artist-list"><ul><li><a href="/artist/some%20artist-all.html">some artist</a></li></ul></div>
+<div class="dj-content">
+<table class="dj-desc">
+<tr><td>Series</td><td><ul class="comma-list"><li><a href="/series/original-all.html">original</a></li></ul></td></tr>
+<tr><td>Type</td><td><a href="/type/doujinshi-all.html">doujinshi</a></td></tr>
+<tr><td>Language</td><td><a href="/index-korean.html">한국어</a></td></tr>
+<tr><td>Tags</td><td class="relatedtags"><ul class="tags"><li><a href="/tag/female%3Abig%20breasts-all.html">big breasts ♀</a></li><li><a href="/tag/full%20color-all.html">full color</a></li></ul></td></tr>
+</table>
+<p class="date" data-posted="2023-10-10 13:19:00-05">2023-10-10 13:19</p>
+</div>
+</div>`
+
+func TestParseGalleryBlock(t *testing.T) {
+	block, err := parseGalleryBlock(sampleGalleryBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Id != "1234567" || block.Title != "Sample & Title" {
+		t.Errorf("Id, Title = %q, %q", block.Id, block.Title)
+	}
+	if len(block.Artists) != 1 || block.Artists[0] != "some artist" {
+		t.Errorf("Artists = %v", block.Artists)
+	}
+	if len(block.Series) != 1 || block.Series[0] != "original" {
+		t.Errorf("Series = %v", block.Series)
+	}
+	if block.Type != GalleryTypeDoujinshi || block.Language != "korean" {
+		t.Errorf("Type, Language = %v, %q", block.Type, block.Language)
+	}
+	wantTags := []Tag{{Namespace: "female", Name: "big breasts"}, {Namespace: "tag", Name: "full color"}}
+	if len(block.Tags) != len(wantTags) || block.Tags[0] != wantTags[0] || block.Tags[1] != wantTags[1] {
+		t.Errorf("Tags = %v", block.Tags)
+	}
+	if len(block.ThumbnailHashes) != 2 {
+		t.Errorf("ThumbnailHashes = %v", block.ThumbnailHashes)
+	}
+	if !block.Published.Equal(time.Date(2023, 10, 10, 18, 19, 0, 0, time.UTC)) {
+		t.Errorf("Published = %v", block.Published)
+	}
+
+	if _, err := parseGalleryBlock("<html>error</html>"); err == nil {
+		t.Error("parseGalleryBlock(invalid) succeeded")
+	}
+}
+
+func TestClient_GalleryBlock(t *testing.T) {
+	c := NewClient(DefaultOptions().WithClient(stub.Client(func(req *http.Request) *http.Response {
+		if req.URL.String() != "https://ltn.hitomi.la/galleryblock/1234567.html" {
+			return stub.Response(404, "")
+		}
+		return stub.Response(200, sampleGalleryBlock)
+	})))
+	block, err := c.GalleryBlock("1234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Id != "1234567" {
+		t.Errorf("Id = %q", block.Id)
+	}
+	if _, err := c.GalleryBlock("1"); err == nil {
+		t.Error("GalleryBlock(missing) succeeded")
+	}
+}
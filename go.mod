@@ -1,8 +1,11 @@
 module github.com/EINNN7/hitomi
 
-go 1.21
+go 1.23
 
-require github.com/rs/zerolog v1.31.0
+require (
+	github.com/rs/zerolog v1.31.0
+	golang.org/x/image v0.18.0
+)
 
 require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
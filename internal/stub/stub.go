@@ -0,0 +1,192 @@
+// Package stub fakes hitomi servers for tests, so that they run without network.
+package stub
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Script is a gg.js which client can calculate file urls with.
+const Script = "case 1: o = 1; break; b: '1700000000/'"
+
+// RoundTripFunc serves requests without network.
+type RoundTripFunc func(req *http.Request) *http.Response
+
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+// Client returns a client whose requests are served by f.
+func Client(f RoundTripFunc) *http.Client {
+	return &http.Client{Transport: f}
+}
+
+// Response returns a response of status with body.
+func Response(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Header:        http.Header{},
+	}
+}
+
+// Nozomi returns content of a nozomi file listing ids.
+func Nozomi(ids ...int) string {
+	content := make([]byte, len(ids)*4)
+	for i, id := range ids {
+		binary.BigEndian.PutUint32(content[i*4:], uint32(id))
+	}
+	return string(content)
+}
+
+// Hitomi is a fake of hitomi servers serving index versions, gg.js, gallery scripts, nozomi files and images.
+// Anything not set is responded with 404. It is safe for concurrent use,
+// so that it can be changed while a client is using it.
+type Hitomi struct {
+	mu        sync.Mutex
+	version   string
+	galleries map[int]string
+	nozomi    map[string][]int
+	files     map[string]string
+	status    map[string]int
+	handler   RoundTripFunc
+	requests  []*http.Request
+}
+
+// New returns a fake serving nothing but version "1" of every index and Script.
+func New() *Hitomi {
+	return &Hitomi{
+		version:   "1",
+		galleries: map[int]string{},
+		nozomi:    map[string][]int{},
+		files:     map[string]string{},
+		status:    map[string]int{},
+	}
+}
+
+// SetVersion sets version of every index.
+func (h *Hitomi) SetVersion(version string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version = version
+}
+
+// SetGallery sets gallery script of id, which is the json without "var galleryinfo = ".
+func (h *Hitomi) SetGallery(id int, script string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.galleries[id] = script
+}
+
+// SetNozomi sets ids of nozomi file at path relative to /n/, like "index-korean.nozomi".
+func (h *Hitomi) SetNozomi(path string, ids ...int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nozomi[path] = ids
+}
+
+// SetFile sets content of image of hash.
+func (h *Hitomi) SetFile(hash, content string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files[hash] = content
+}
+
+// SetStatus makes requests of url path respond status without body, or be served as usual if status is 0.
+func (h *Hitomi) SetStatus(path string, status int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if status == 0 {
+		delete(h.status, path)
+	} else {
+		h.status[path] = status
+	}
+}
+
+// Handle makes f serve requests first, which returns nil to let a request be served as usual.
+// f is called without locking h, so it may change h.
+func (h *Hitomi) Handle(f RoundTripFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler = f
+}
+
+// Requests returns requests served so far.
+func (h *Hitomi) Requests() []*http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*http.Request(nil), h.requests...)
+}
+
+// Client returns a client whose requests are served by h.
+func (h *Hitomi) Client() *http.Client {
+	return &http.Client{Transport: h}
+}
+
+func (h *Hitomi) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.mu.Lock()
+	h.requests = append(h.requests, req)
+	handler := h.handler
+	h.mu.Unlock()
+	if handler != nil {
+		if resp := handler(req); resp != nil {
+			return resp, nil
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := req.URL.Path
+	if status, ok := h.status[p]; ok {
+		return Response(status, ""), nil
+	}
+	switch {
+	case strings.HasSuffix(p, "/version"):
+		return Response(200, h.version), nil
+	case p == "/gg.js":
+		return Response(200, Script), nil
+	case strings.HasPrefix(p, "/galleries/"):
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(p, "/galleries/"), ".js"))
+		if script, ok := h.galleries[id]; ok && err == nil {
+			return Response(200, "var galleryinfo = "+script), nil
+		}
+	case strings.HasPrefix(p, "/n/"):
+		if ids, ok := h.nozomi[strings.TrimPrefix(p, "/n/")]; ok {
+			return rangeResponse(req, Nozomi(ids...)), nil
+		}
+	default:
+		hash := strings.TrimSuffix(path.Base(p), path.Ext(p))
+		if content, ok := h.files[hash]; ok {
+			resp := Response(200, content)
+			resp.Header.Set("Content-Type", "image/webp")
+			return resp, nil
+		}
+	}
+	return Response(404, ""), nil
+}
+
+// rangeResponse responds content, honouring Range header of req.
+func rangeResponse(req *http.Request, content string) *http.Response {
+	var start, end int
+	n, _ := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+	switch n {
+	case 0:
+		return Response(200, content)
+	case 1:
+		end = len(content) - 1
+	}
+	if start >= len(content) {
+		return Response(http.StatusRequestedRangeNotSatisfiable, "")
+	}
+	end = min(end, len(content)-1)
+	resp := Response(http.StatusPartialContent, content[start:end+1])
+	resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+	return resp
+}
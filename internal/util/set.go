@@ -0,0 +1,48 @@
+package util
+
+// Intersect returns elements of a which are also in b, keeping the order of a.
+func Intersect(a, b []int) []int {
+	set := make(map[int]struct{}, len(b))
+	for _, v := range b {
+		set[v] = struct{}{}
+	}
+	result := make([]int, 0, min(len(a), len(b)))
+	for _, v := range a {
+		if _, ok := set[v]; ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Subtract returns elements of a which are not in b, keeping the order of a.
+func Subtract(a, b []int) []int {
+	set := make(map[int]struct{}, len(b))
+	for _, v := range b {
+		set[v] = struct{}{}
+	}
+	result := make([]int, 0, len(a))
+	for _, v := range a {
+		if _, ok := set[v]; !ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Union returns elements of a followed by elements of b which are not in a.
+func Union(a, b []int) []int {
+	set := make(map[int]struct{}, len(a))
+	result := make([]int, 0, len(a)+len(b))
+	for _, v := range a {
+		set[v] = struct{}{}
+		result = append(result, v)
+	}
+	for _, v := range b {
+		if _, ok := set[v]; !ok {
+			set[v] = struct{}{}
+			result = append(result, v)
+		}
+	}
+	return result
+}
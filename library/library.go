@@ -0,0 +1,290 @@
+// Package library keeps a catalog of downloaded galleries on disk.
+//
+// Each gallery is stored as a JSON file in the library directory,
+// so the catalog can be inspected and backed up with ordinary tools.
+package library
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// Formats of downloaded galleries.
+const (
+	FormatImages = "images"
+	FormatVideo  = "video"
+	FormatCBZ    = "cbz"
+	FormatEPUB   = "epub"
+	FormatPDF    = "pdf"
+)
+
+// Entry is a downloaded gallery.
+type Entry struct {
+	ID int
+	// Gallery is the metadata snapshot at the time of download.
+	Gallery *hitomi.Gallery
+	Files   []File
+	// Format is how the gallery is stored, one of Format constants.
+	Format       string
+	DownloadedAt time.Time
+}
+
+// File is a local file of downloaded gallery.
+type File struct {
+	Path string
+	// Hash is hex-encoded sha256 of the file content.
+	Hash string
+	Size int64
+}
+
+// NewEntry returns entry of gallery stored in files of paths, hashing them.
+func NewEntry(g *hitomi.Gallery, format string, paths ...string) (*Entry, error) {
+	id, err := strconv.Atoi(g.Id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gallery id: %s", g.Id)
+	}
+	entry := &Entry{
+		ID:           id,
+		Gallery:      g,
+		Format:       format,
+		DownloadedAt: time.Now(),
+	}
+	for _, path := range paths {
+		file, err := NewFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entry.Files = append(entry.Files, file)
+	}
+	return entry, nil
+}
+
+// NewFile returns File of path, hashing its content.
+func NewFile(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return File{}, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Path: abs, Hash: hex.EncodeToString(hash.Sum(nil)), Size: size}, nil
+}
+
+// Library is a catalog of downloaded galleries.
+// It is safe for concurrent use.
+type Library struct {
+	dir string
+
+	mu      sync.RWMutex
+	entries map[int]*Entry
+	// index is built on first search, and reset when entries change.
+	index *index
+}
+
+// Open opens library in dir, creating it if it does not exist.
+func Open(dir string) (*Library, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Library{
+		dir:     dir,
+		entries: map[int]*Entry{},
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		entry := new(Entry)
+		if err := json.Unmarshal(content, entry); err != nil {
+			return nil, fmt.Errorf("invalid entry %s: %w", name, err)
+		}
+		l.entries[entry.ID] = entry
+	}
+	return l, nil
+}
+
+func (l *Library) path(id int) string {
+	return filepath.Join(l.dir, strconv.Itoa(id)+".json")
+}
+
+// Add adds entry to library, replacing existing entry of the same gallery.
+func (l *Library) Add(entry *Entry) error {
+	content, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to temporary file first so that a crash never leaves a broken entry
+	f, err := os.CreateTemp(l.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.Rename(f.Name(), l.path(entry.ID)); err != nil {
+		return err
+	}
+	l.entries[entry.ID] = entry
+	l.index = nil
+	return nil
+}
+
+// Remove removes entry of gallery from library. Files of the entry are not removed.
+func (l *Library) Remove(id int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.Remove(l.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(l.entries, id)
+	l.index = nil
+	return nil
+}
+
+// Get returns entry of gallery.
+func (l *Library) Get(id int) (*Entry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entry, ok := l.entries[id]
+	return entry, ok
+}
+
+// Entries returns every entry, newest gallery first.
+func (l *Library) Entries() []*Entry {
+	return l.Find(func(*Entry) bool { return true })
+}
+
+// Find returns entries matching f, newest gallery first.
+func (l *Library) Find(f func(entry *Entry) bool) []*Entry {
+	l.mu.RLock()
+	var result []*Entry
+	for _, entry := range l.entries {
+		if f(entry) {
+			result = append(result, entry)
+		}
+	}
+	l.mu.RUnlock()
+	slices.SortFunc(result, func(a, b *Entry) int { return b.ID - a.ID })
+	return result
+}
+
+// ByTag returns entries of galleries with tag.
+func (l *Library) ByTag(tag hitomi.Tag) []*Entry {
+	return l.Find(func(entry *Entry) bool {
+		return slices.Contains(entry.Gallery.Tags, tag)
+	})
+}
+
+// ByArtist returns entries of galleries by artist.
+func (l *Library) ByArtist(artist string) []*Entry {
+	return l.Find(func(entry *Entry) bool {
+		for _, a := range entry.Gallery.Artists {
+			if strings.EqualFold(a.Artist, artist) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// ByLanguage returns entries of galleries in language, like "korean".
+func (l *Library) ByLanguage(language string) []*Entry {
+	return l.Find(func(entry *Entry) bool {
+		return strings.EqualFold(entry.Gallery.Language, language)
+	})
+}
+
+// Update is a gallery whose upstream metadata differs from the snapshot in library.
+type Update struct {
+	Entry  *Entry
+	Latest *hitomi.Gallery
+}
+
+// Outdated fetches metadata of every gallery in library and returns galleries whose metadata has changed.
+// Galleries which failed to fetch are reported in the returned error, along with the updates found.
+func (l *Library) Outdated(ctx context.Context, client *hitomi.Client, opts *hitomi.BatchOptions) ([]Update, error) {
+	entries := l.Entries()
+	ids := make([]int, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	var updates []Update
+	var errs []error
+	for result := range client.Galleries(ctx, ids, opts) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			continue
+		}
+		entry, ok := l.Get(result.Id)
+		if !ok {
+			// removed while fetching
+			continue
+		}
+		changed, err := metadataChanged(entry.Gallery, result.Gallery)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if changed {
+			updates = append(updates, Update{Entry: entry, Latest: result.Gallery})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	slices.SortFunc(updates, func(a, b Update) int { return b.Entry.ID - a.Entry.ID })
+	return updates, errors.Join(errs...)
+}
+
+// metadataChanged reports whether metadata of gallery differs, comparing their JSON forms
+// since the snapshot is stored as JSON.
+func metadataChanged(old, latest *hitomi.Gallery) (bool, error) {
+	a, err := json.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+	b, err := json.Marshal(latest)
+	if err != nil {
+		return false, err
+	}
+	return string(a) != string(b), nil
+}
@@ -0,0 +1,166 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+// testGallery returns gallery decoded from json.
+func testGallery(t *testing.T, script string) *hitomi.Gallery {
+	g := new(hitomi.Gallery)
+	if err := json.Unmarshal([]byte(script), g); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+var testGalleries = []string{
+	`{"Id": "1", "Title": "one", "Language": "korean", "Type": "manga",
+		"Artists": [{"Artist": "alice"}], "Groups": [{"Group": "team"}],
+		"Tags": [{"Namespace": "female", "Name": "glasses"}, {"Namespace": "tag", "Name": "full color"}]}`,
+	`{"Id": "2", "Title": "two", "Language": "english", "Type": "doujinshi",
+		"Artists": [{"Artist": "bob"}], "Parodies": [{"Parody": "original"}],
+		"Tags": [{"Namespace": "female", "Name": "glasses"}]}`,
+	`{"Id": "3", "Title": "three", "Language": "english", "Type": "artistcg",
+		"Artists": [{"Artist": "Alice"}], "Characters": [{"Character": "someone"}],
+		"Tags": [{"Namespace": "male", "Name": "glasses"}]}`,
+}
+
+// newTestLibrary returns library with testGalleries.
+func newTestLibrary(t *testing.T) (*Library, string) {
+	dir := t.TempDir()
+	l, err := Open(filepath.Join(dir, "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range testGalleries {
+		g := testGallery(t, script)
+		path := filepath.Join(dir, g.Id+".cbz")
+		if err := os.WriteFile(path, []byte("content of "+g.Id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := NewEntry(g, FormatCBZ, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l, dir
+}
+
+func ids(entries []*Entry) []int {
+	result := make([]int, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.ID
+	}
+	return result
+}
+
+func TestLibrary(t *testing.T) {
+	l, dir := newTestLibrary(t)
+	l, err := Open(filepath.Join(dir, "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, ok := l.Get(2)
+	if !ok {
+		t.Fatal("entry 2 not found after reopen")
+	}
+	if entry.Format != FormatCBZ || entry.Gallery.Type != hitomi.GalleryTypeDoujinshi || len(entry.Files) != 1 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Files[0].Size != 12 || len(entry.Files[0].Hash) != 64 {
+		t.Errorf("file = %+v", entry.Files[0])
+	}
+
+	if got := ids(l.Entries()); len(got) != 3 || got[0] != 3 {
+		t.Errorf("Entries = %v", got)
+	}
+	if got := ids(l.ByTag(hitomi.Tag{Namespace: "female", Name: "glasses"})); len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Errorf("ByTag = %v", got)
+	}
+	if got := ids(l.ByArtist("alice")); len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("ByArtist = %v", got)
+	}
+	if got := ids(l.ByLanguage("English")); len(got) != 2 {
+		t.Errorf("ByLanguage = %v", got)
+	}
+
+	if err := l.Remove(2); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Open(filepath.Join(dir, "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Get(2); ok {
+		t.Error("entry 2 exists after remove")
+	}
+}
+
+func TestLibrary_Outdated(t *testing.T) {
+	l, _ := newTestLibrary(t)
+	h := stub.New()
+	script := `{"id": "1", "title": "one", "language": "korean", "type": "manga",
+		"artists": [{"artist": "alice"}], "groups": [{"group": "team"}],
+		"tags": [{"tag": "glasses", "female": "1"}, {"tag": "full color"}]}`
+	h.SetGallery(1, script)
+	h.SetGallery(2, strings.Replace(script, `"id": "1", "title": "one"`, `"id": "2", "title": "renamed"`, 1))
+	client := hitomi.NewClient(hitomi.DefaultOptions().WithClient(h.Client()))
+
+	// entry 1 is recorded from the same script served by client
+	latest, err := client.Gallery("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := l.Get(1)
+	entry.Gallery = latest
+	if err := l.Add(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := l.Outdated(context.Background(), client, nil)
+	if err == nil {
+		t.Error("Outdated did not report failed gallery")
+	}
+	if len(updates) != 1 || updates[0].Entry.ID != 2 || updates[0].Latest.Title != "renamed" {
+		t.Errorf("updates = %+v", updates)
+	}
+}
+
+func TestLibrary_Outdated_Removed(t *testing.T) {
+	l, _ := newTestLibrary(t)
+	h := stub.New()
+	for id := 1; id <= 3; id++ {
+		h.SetGallery(id, fmt.Sprintf(`{"id": "%d", "title": "renamed"}`, id))
+	}
+	h.Handle(func(req *http.Request) *http.Response {
+		// the gallery is removed from library while it is fetched
+		if err := l.Remove(2); err != nil {
+			t.Error(err)
+		}
+		return nil
+	})
+	client := hitomi.NewClient(hitomi.DefaultOptions().WithClient(h.Client()))
+	updates, err := l.Outdated(context.Background(), client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, update := range updates {
+		if update.Entry.ID == 2 {
+			t.Errorf("removed gallery is reported: %+v", update)
+		}
+	}
+}
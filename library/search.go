@@ -0,0 +1,129 @@
+package library
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/util"
+)
+
+// index is an inverted index of library entries.
+// Every id list is sorted newest gallery first.
+type index struct {
+	ids  []int
+	tags map[hitomi.Tag][]int
+	// titles are lowercased titles of galleries, including japanese title.
+	titles map[int][]string
+}
+
+// newIndex builds index of entries.
+func newIndex(entries map[int]*Entry) *index {
+	idx := &index{
+		tags:   map[hitomi.Tag][]int{},
+		titles: map[int][]string{},
+	}
+	for id := range entries {
+		idx.ids = append(idx.ids, id)
+	}
+	slices.SortFunc(idx.ids, func(a, b int) int { return b - a })
+	for _, id := range idx.ids {
+		g := entries[id].Gallery
+		if g == nil {
+			continue
+		}
+		for _, tag := range g.QueryTags() {
+			ids := idx.tags[tag]
+			// a gallery may have the same tag twice, such as artists differing only in case
+			if len(ids) == 0 || ids[len(ids)-1] != id {
+				idx.tags[tag] = append(ids, id)
+			}
+		}
+		idx.titles[id] = append(idx.titles[id], strings.ToLower(g.Title))
+		if g.JapaneseTitle != nil {
+			idx.titles[id] = append(idx.titles[id], strings.ToLower(*g.JapaneseTitle))
+		}
+	}
+	return idx
+}
+
+// eval returns ids of galleries matching expr.
+func (idx *index) eval(expr hitomi.Expr) ([]int, error) {
+	switch expr := expr.(type) {
+	case nil:
+		return idx.ids, nil
+	case *hitomi.TermExpr:
+		if expr.Tag.Namespace == "" {
+			return idx.titleIDs(expr.Tag.Name), nil
+		}
+		return idx.tags[expr.Tag], nil
+	case *hitomi.NotExpr:
+		ids, err := idx.eval(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return util.Subtract(idx.ids, ids), nil
+	case *hitomi.AndExpr:
+		ids := idx.ids
+		for _, e := range expr.Exprs {
+			matched, err := idx.eval(e)
+			if err != nil {
+				return nil, err
+			}
+			ids = util.Intersect(ids, matched)
+		}
+		return ids, nil
+	case *hitomi.OrExpr:
+		var ids []int
+		for _, e := range expr.Exprs {
+			matched, err := idx.eval(e)
+			if err != nil {
+				return nil, err
+			}
+			ids = util.Union(ids, matched)
+		}
+		// ids of different terms are mixed, so sort them newest first again
+		slices.SortFunc(ids, func(a, b int) int { return b - a })
+		return ids, nil
+	}
+	return nil, fmt.Errorf("unknown expression: %T", expr)
+}
+
+// titleIDs returns ids of galleries whose title contains text.
+func (idx *index) titleIDs(text string) []int {
+	var ids []int
+	for _, id := range idx.ids {
+		if slices.ContainsFunc(idx.titles[id], func(title string) bool {
+			return strings.Contains(title, text)
+		}) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Search returns entries matching query, newest gallery first.
+// Query has the same syntax as hitomi.ParseQuery and is evaluated against
+// the metadata stored in library, so no network access is made.
+// Terms without namespace match substrings of gallery titles.
+func (l *Library) Search(query string) ([]*Entry, error) {
+	expr, err := hitomi.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.index == nil {
+		l.index = newIndex(l.entries)
+	}
+	ids, err := l.index.eval(expr)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Entry, len(ids))
+	for i, id := range ids {
+		result[i] = l.entries[id]
+	}
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package library
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLibrary_Search(t *testing.T) {
+	l, _ := newTestLibrary(t)
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{3, 2, 1}},
+		{"female:glasses", []int{2, 1}},
+		{"female:glasses -tag:full_color", []int{2}},
+		{"female:glasses language:english", []int{2}},
+		{"artist:alice", []int{3, 1}},
+		{"group:team | series:original", []int{2, 1}},
+		{"character:someone type:artistcg", []int{3}},
+		{"-language:english", []int{1}},
+		{"-(artist:alice | male:glasses)", []int{2}},
+		{"t", []int{3, 2}},
+		{"tw | one", []int{2, 1}},
+		{"female:unknown", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			entries, err := l.Search(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(entries); !slices.Equal(got, tt.want) && len(got)+len(tt.want) > 0 {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := l.Search("(female:glasses"); err == nil {
+		t.Error("Search did not fail on invalid query")
+	}
+	if err := l.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := l.Search("female:glasses"); !slices.Equal(ids(entries), []int{2}) {
+		t.Errorf("Search after Remove = %v", ids(entries))
+	}
+}
@@ -24,6 +24,11 @@ type Options struct {
 	// it can be extremely slow the first time (especially for gallery index) and consume much memory space,
 	// but it will be a lot faster when you search.
 	CacheWholeIndex bool
+
+	// ResultTTL is how long Search reuses results of a query and the index version they were made with.
+	// nozomi files change without index versions changing, so results older than it are searched again.
+	// if it is 0, results are never reused.
+	ResultTTL time.Duration
 }
 
 func (o *Options) WithClient(c *http.Client) *Options {
@@ -46,6 +51,11 @@ func (o *Options) WithCacheWholeIndex(b bool) *Options {
 	return o
 }
 
+func (o *Options) WithResultTTL(d time.Duration) *Options {
+	o.ResultTTL = d
+	return o
+}
+
 func DefaultOptions() *Options {
 	return &Options{
 		Client:               &http.Client{},
@@ -53,5 +63,6 @@ func DefaultOptions() *Options {
 		UpdateScriptInterval: -1,
 
 		CacheWholeIndex: false,
+		ResultTTL:       5 * time.Minute,
 	}
 }
@@ -0,0 +1,313 @@
+package hitomi
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Query syntax
+//
+//	query  = or
+//	or     = and { ("|" | "OR") and }
+//	and    = unary { unary }
+//	unary  = "-" unary | "(" or ")" | term
+//	term   = [ namespace ":" ] ( word | '"' phrase '"' )
+//
+// Terms separated by spaces must all match, and "|" has lower precedence than spaces.
+// Underscores in terms are treated as spaces, so "female:big_breasts" and
+// `female:"big breasts"` are the same term. Terms without namespace are searched in gallery titles.
+
+// QueryNamespaces are namespaces allowed in queries.
+var QueryNamespaces = []string{
+	NamespaceArtist,
+	NamespaceGroup,
+	NamespaceSeries,
+	NamespaceCharacter,
+	NamespaceType,
+	NamespaceLanguage,
+	NamespaceFemale,
+	NamespaceMale,
+	NamespaceTag,
+}
+
+// Expr is a node of parsed query.
+type Expr interface {
+	// String returns canonical form of the expression.
+	String() string
+	expr()
+}
+
+// TermExpr matches galleries with the tag.
+// Tag.Namespace is empty if the term is searched in gallery titles.
+type TermExpr struct {
+	Tag Tag
+	// Pos is the byte offset of the term in the query.
+	Pos int
+}
+
+// NotExpr matches galleries not matching Expr.
+type NotExpr struct {
+	Expr Expr
+}
+
+// AndExpr matches galleries matching all of Exprs.
+type AndExpr struct {
+	Exprs []Expr
+}
+
+// OrExpr matches galleries matching any of Exprs.
+type OrExpr struct {
+	Exprs []Expr
+}
+
+func (*TermExpr) expr() {}
+func (*NotExpr) expr()  {}
+func (*AndExpr) expr()  {}
+func (*OrExpr) expr()   {}
+
+// String returns the term as written in queries, quoting names which would otherwise parse differently.
+func (e *TermExpr) String() string {
+	name := e.Tag.Name
+	if e.Tag.Namespace == "" {
+		if strings.ContainsAny(name, " ()|:") || strings.HasPrefix(name, "-") {
+			return `"` + name + `"`
+		}
+		return name
+	}
+	if strings.ContainsAny(name, "()|") {
+		return e.Tag.Namespace + `:"` + name + `"`
+	}
+	return e.Tag.String()
+}
+
+func (e *NotExpr) String() string {
+	return "-" + groupString(e.Expr)
+}
+
+func (e *AndExpr) String() string {
+	parts := make([]string, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		parts[i] = groupString(expr)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *OrExpr) String() string {
+	parts := make([]string, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		if _, ok := expr.(*AndExpr); ok {
+			parts[i] = "(" + expr.String() + ")"
+		} else {
+			parts[i] = expr.String()
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// groupString returns string of expr, parenthesized if it has multiple children.
+func groupString(expr Expr) string {
+	switch expr.(type) {
+	case *AndExpr, *OrExpr:
+		return "(" + expr.String() + ")"
+	}
+	return expr.String()
+}
+
+// QueryError is an error of parsing query.
+type QueryError struct {
+	// Pos is the byte offset in the query where the error occurred.
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at %d: %s", e.Pos, e.Msg)
+}
+
+// ParseQuery parses query into expression.
+// It returns nil expression for empty query, which matches every gallery.
+func ParseQuery(query string) (Expr, error) {
+	p := &queryParser{query: query}
+	p.skipSpace()
+	if p.pos == len(p.query) {
+		return nil, nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.query) {
+		return nil, &QueryError{Pos: p.pos, Msg: fmt.Sprintf("unexpected %q", p.query[p.pos])}
+	}
+	return expr, nil
+}
+
+type queryParser struct {
+	query string
+	pos   int
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.query) && isQuerySpace(p.query[p.pos]) {
+		p.pos++
+	}
+}
+
+// atOr reports whether the parser is at an or operator, consuming it if so.
+func (p *queryParser) atOr() bool {
+	if strings.HasPrefix(p.query[p.pos:], "|") {
+		p.pos++
+		return true
+	}
+	if rest, ok := strings.CutPrefix(p.query[p.pos:], "OR"); ok && (rest == "" || isQuerySpace(rest[0]) || rest[0] == '(') {
+		p.pos += 2
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) parseOr() (Expr, error) {
+	var exprs []Expr
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if or, ok := expr.(*OrExpr); ok {
+			exprs = append(exprs, or.Exprs...)
+		} else {
+			exprs = append(exprs, expr)
+		}
+		p.skipSpace()
+		start := p.pos
+		if !p.atOr() {
+			break
+		}
+		p.skipSpace()
+		if p.pos == len(p.query) || p.query[p.pos] == ')' {
+			return nil, &QueryError{Pos: start, Msg: "missing term after or"}
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &OrExpr{Exprs: exprs}, nil
+}
+
+func (p *queryParser) parseAnd() (Expr, error) {
+	var exprs []Expr
+	for {
+		p.skipSpace()
+		if p.pos == len(p.query) || p.query[p.pos] == ')' {
+			break
+		}
+		start := p.pos
+		if p.atOr() {
+			p.pos = start
+			break
+		}
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if and, ok := expr.(*AndExpr); ok {
+			exprs = append(exprs, and.Exprs...)
+		} else {
+			exprs = append(exprs, expr)
+		}
+	}
+	switch len(exprs) {
+	case 0:
+		return nil, &QueryError{Pos: p.pos, Msg: "missing term"}
+	case 1:
+		return exprs[0], nil
+	}
+	return &AndExpr{Exprs: exprs}, nil
+}
+
+func (p *queryParser) parseUnary() (Expr, error) {
+	switch p.query[p.pos] {
+	case '-':
+		p.pos++
+		if p.pos == len(p.query) || isQuerySpace(p.query[p.pos]) {
+			return nil, &QueryError{Pos: p.pos - 1, Msg: "missing term after -"}
+		}
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if not, ok := expr.(*NotExpr); ok {
+			return not.Expr, nil
+		}
+		return &NotExpr{Expr: expr}, nil
+	case '(':
+		start := p.pos
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.query) || p.query[p.pos] != ')' {
+			return nil, &QueryError{Pos: start, Msg: "unclosed parenthesis"}
+		}
+		p.pos++
+		return expr, nil
+	case ')':
+		return nil, &QueryError{Pos: p.pos, Msg: "unexpected )"}
+	}
+	return p.parseTerm()
+}
+
+func (p *queryParser) parseTerm() (Expr, error) {
+	start := p.pos
+	var namespace string
+	var name strings.Builder
+	var quoted bool
+	for p.pos < len(p.query) {
+		c := p.query[p.pos]
+		if isQuerySpace(c) || c == '(' || c == ')' || c == '|' {
+			break
+		}
+		switch {
+		case c == '"':
+			end := strings.IndexByte(p.query[p.pos+1:], '"')
+			if end < 0 {
+				return nil, &QueryError{Pos: p.pos, Msg: "unclosed quote"}
+			}
+			name.WriteString(p.query[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+			quoted = true
+			continue
+		case c == ':' && namespace == "" && !quoted:
+			namespace = strings.ToLower(name.String())
+			if namespace == "" {
+				return nil, &QueryError{Pos: start, Msg: "missing namespace"}
+			}
+			name.Reset()
+		default:
+			name.WriteByte(c)
+		}
+		p.pos++
+	}
+
+	term := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(name.String(), "_", " ")))
+	term = strings.Join(strings.Fields(term), " ")
+	if namespace != "" && !slices.Contains(QueryNamespaces, namespace) {
+		return nil, &QueryError{Pos: start, Msg: fmt.Sprintf("unknown namespace %q", namespace)}
+	}
+	if term == "" {
+		return nil, &QueryError{Pos: start, Msg: "empty term"}
+	}
+	if namespace == NamespaceType && ParseGalleryType(term) == GalleryTypeUnknown {
+		return nil, &QueryError{Pos: start, Msg: fmt.Sprintf("unknown type %q", term)}
+	}
+	return &TermExpr{Tag: Tag{Namespace: namespace, Name: term}, Pos: start}, nil
+}
+
+// isQuerySpace reports whether c separates terms.
+// Only ascii spaces are checked since the query is scanned byte by byte.
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,79 @@
+package hitomi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"female:big_breasts", "female:big_breasts"},
+		{`Female:"Big Breasts"  language:korean`, "female:big_breasts language:korean"},
+		{"-tag:full_color", "-tag:full_color"},
+		{"--tag:full_color", "tag:full_color"},
+		{`"school uniform" glasses`, `"school uniform" glasses`},
+		{"artist:a | artist:b", "artist:a | artist:b"},
+		{"artist:a OR artist:b OR (artist:c)", "artist:a | artist:b | artist:c"},
+		{"(artist:a | artist:b) language:english", "(artist:a | artist:b) language:english"},
+		{"artist:a language:english | artist:b", "(artist:a language:english) | artist:b"},
+		{"-(type:manga | type:doujinshi)", "-(type:manga | type:doujinshi)"},
+		{"series:a:b", "series:a:b"},
+		{"오리지널", "오리지널"},
+		{`character:"saber (fate)"`, `character:"saber (fate)"`},
+		{`series:"a|b"`, `series:"a|b"`},
+		{`"a:b" "-c"`, `"a:b" "-c"`},
+	}
+	for _, tt := range tests {
+		expr, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.in, err)
+			continue
+		}
+		if got := expr.String(); got != tt.want {
+			t.Errorf("ParseQuery(%q).String() = %q, want %q", tt.in, got, tt.want)
+			continue
+		}
+		again, err := ParseQuery(tt.want)
+		if err != nil || again.String() != tt.want {
+			t.Errorf("canonical form %q does not round trip: %v", tt.want, err)
+		}
+	}
+
+	expr, err := ParseQuery("  ")
+	if expr != nil || err != nil {
+		t.Errorf("ParseQuery(empty) = %v, %v", expr, err)
+	}
+}
+
+func TestParseQuery_Error(t *testing.T) {
+	tests := []struct {
+		in  string
+		pos int
+	}{
+		{"foo:bar", 0},
+		{"female:big_breasts colour:red", 19},
+		{"female:", 0},
+		{`tag:"full color`, 4},
+		{"(artist:a | artist:b", 0},
+		{"artist:a )", 9},
+		{"artist:a |", 9},
+		{"| artist:a", 0},
+		{"- artist:a", 0},
+		{"type:novel", 0},
+		{":foo", 0},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.in)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("ParseQuery(%q) error = %v, want QueryError", tt.in, err)
+			continue
+		}
+		if queryErr.Pos != tt.pos {
+			t.Errorf("ParseQuery(%q) error at %d, want %d: %v", tt.in, queryErr.Pos, tt.pos, err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package hitomi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EINNN7/hitomi/internal/util"
+)
+
+// maxCachedResults is the number of search results kept by Search to resume cursors.
+const maxCachedResults = 64
+
+// ErrIndexChanged is returned when a cursor was made with different version of index.
+var ErrIndexChanged = errors.New("index changed")
+
+// IndexChangedError reports which index changed since a cursor was made.
+type IndexChangedError struct {
+	Index      string
+	OldVersion string
+	NewVersion string
+}
+
+func (e *IndexChangedError) Error() string {
+	return fmt.Sprintf("index changed: %s %s -> %s", e.Index, e.OldVersion, e.NewVersion)
+}
+
+func (e *IndexChangedError) Is(target error) bool {
+	return target == ErrIndexChanged
+}
+
+// SearchResult is a result of Search.Query.
+type SearchResult struct {
+	// Query is the canonical form of query used to search.
+	Query string
+	// IDs are ids of matched galleries, newest first.
+	IDs []int
+	// IndexVersions are versions of indexes used to search.
+	IndexVersions map[string]string
+}
+
+// Total returns the number of matched galleries.
+func (r *SearchResult) Total() int {
+	return len(r.IDs)
+}
+
+// Page returns ids of n-th page, starting from 0.
+func (r *SearchResult) Page(n, size int) []int {
+	if n < 0 || size <= 0 {
+		return nil
+	}
+	return r.Range(n*size, size)
+}
+
+// Range returns at most count ids from offset.
+func (r *SearchResult) Range(offset, count int) []int {
+	if offset < 0 || offset >= len(r.IDs) || count <= 0 {
+		return nil
+	}
+	return r.IDs[offset:min(offset+count, len(r.IDs))]
+}
+
+// Cursor returns an opaque cursor pointing offset of the result,
+// which can be resumed by Search.Resume.
+func (r *SearchResult) Cursor(offset int) string {
+	content, _ := json.Marshal(cursor{Query: r.Query, IndexVersions: r.IndexVersions, Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+type cursor struct {
+	Query         string            `json:"q"`
+	IndexVersions map[string]string `json:"v"`
+	Offset        int               `json:"o"`
+}
+
+// Query searches galleries matching query, see ParseQuery for the syntax.
+// Empty query matches every gallery.
+func (s *Search) Query(query string) (*SearchResult, error) {
+	expr, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if expr != nil {
+		query = expr.String()
+	} else {
+		query = ""
+	}
+	versions, err := s.queryIndexVersions()
+	if err != nil {
+		return nil, err
+	}
+	if result, ok := s.cachedResult(query, versions); ok {
+		return result, nil
+	}
+
+	var ids []int
+	var negated bool
+	if expr != nil {
+		if ids, negated, err = s.eval(expr); err != nil {
+			return nil, err
+		}
+	}
+	if expr == nil || negated {
+		all, err := s.GalleryIDs(Tag{Namespace: NamespaceLanguage, Name: "all"})
+		if err != nil {
+			return nil, err
+		}
+		ids = util.Subtract(all, ids)
+	}
+	result := &SearchResult{
+		Query:         query,
+		IDs:           ids,
+		IndexVersions: versions,
+	}
+	s.cacheResult(result)
+	return result, nil
+}
+
+// eval returns ids of galleries matching expr.
+// If negated is true, expr matches every gallery except ids,
+// which avoids fetching every gallery id until it is really needed.
+func (s *Search) eval(expr Expr) (ids []int, negated bool, err error) {
+	switch expr := expr.(type) {
+	case *TermExpr:
+		ids, err := s.termGalleryIDs(expr.Tag)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to search %s: %w", expr, err)
+		}
+		return ids, false, nil
+	case *NotExpr:
+		ids, negated, err := s.eval(expr.Expr)
+		return ids, !negated, err
+	case *AndExpr:
+		// intersection of positives, except union of negatives
+		var positive, negative []int
+		var hasPositive bool
+		for _, e := range expr.Exprs {
+			ids, negated, err := s.eval(e)
+			if err != nil {
+				return nil, false, err
+			}
+			switch {
+			case negated:
+				negative = util.Union(negative, ids)
+			case !hasPositive:
+				positive, hasPositive = ids, true
+			default:
+				positive = util.Intersect(positive, ids)
+			}
+		}
+		if !hasPositive {
+			return negative, true, nil
+		}
+		return util.Subtract(positive, negative), false, nil
+	case *OrExpr:
+		// union of positives, or complement of (intersection of negatives except union of positives)
+		var positive, negative []int
+		var hasNegative bool
+		for _, e := range expr.Exprs {
+			ids, negated, err := s.eval(e)
+			if err != nil {
+				return nil, false, err
+			}
+			switch {
+			case !negated:
+				positive = util.Union(positive, ids)
+			case !hasNegative:
+				negative, hasNegative = ids, true
+			default:
+				negative = util.Intersect(negative, ids)
+			}
+		}
+		if hasNegative {
+			return util.Subtract(negative, positive), true, nil
+		}
+		// ids of different terms are mixed, so sort them newest first again
+		slices.SortFunc(positive, func(a, b int) int { return b - a })
+		return positive, false, nil
+	}
+	return nil, false, fmt.Errorf("unknown expression: %T", expr)
+}
+
+// Resume returns the result and offset pointed by cursor.
+// The result is reused if it is still cached, otherwise the query is searched again.
+// It returns an error which is ErrIndexChanged if any index has changed since the cursor was made.
+func (s *Search) Resume(c string) (*SearchResult, int, error) {
+	content, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var cur cursor
+	if err := json.Unmarshal(content, &cur); err != nil {
+		return nil, 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	// cursors come from clients, so only indexes recorded by Query are fetched
+	for name := range cur.IndexVersions {
+		if !slices.Contains(queryIndexes, name) {
+			return nil, 0, fmt.Errorf("invalid cursor: unknown index %q", name)
+		}
+	}
+	for name, old := range cur.IndexVersions {
+		version, err := s.IndexVersion(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		s.mu.Lock()
+		s.indexVersion[name] = version
+		s.mu.Unlock()
+		if version != old {
+			return nil, 0, &IndexChangedError{Index: name, OldVersion: old, NewVersion: version}
+		}
+	}
+	result, err := s.Query(cur.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, cur.Offset, nil
+}
+
+// queryIndexes are indexes which Query depends on, whose versions are recorded in results and cursors.
+var queryIndexes = []string{"galleriesindex"}
+
+// queryIndexVersions returns versions of indexes which Query depends on,
+// fetching them again if they are older than Options.ResultTTL.
+func (s *Search) queryIndexVersions() (map[string]string, error) {
+	s.mu.Lock()
+	if time.Since(s.versionChecked) >= s.options.ResultTTL {
+		delete(s.indexVersion, "galleriesindex")
+		s.versionChecked = time.Now()
+	}
+	s.mu.Unlock()
+	version, err := s.loadIndexVersion("galleriesindex")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"galleriesindex": version}, nil
+}
+
+func (s *Search) cachedResult(query string, versions map[string]string) (*SearchResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.results = slices.DeleteFunc(s.results, func(c cachedResult) bool { return now.After(c.expires) })
+	for _, c := range s.results {
+		if c.result.Query == query && maps.Equal(c.result.IndexVersions, versions) {
+			return c.result, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Search) cacheResult(result *SearchResult) {
+	if s.options.ResultTTL <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.results) >= maxCachedResults {
+		s.results = s.results[1:]
+	}
+	s.results = append(s.results, cachedResult{result: result, expires: time.Now().Add(s.options.ResultTTL)})
+}
+
+// termGalleryIDs returns ids of galleries with the tag.
+// Tags without namespace are searched in gallery titles.
+func (s *Search) termGalleryIDs(tag Tag) ([]int, error) {
+	if tag.Namespace != "" {
+		return s.GalleryIDs(tag)
+	}
+	// galleriesindex only has single words
+	var result []int
+	for i, word := range strings.Fields(tag.Name) {
+		ids, err := s.wordGalleryIDs(word)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			result = ids
+		} else {
+			result = util.Intersect(result, ids)
+		}
+	}
+	return result, nil
+}
+
+// wordGalleryIDs returns ids of galleries with the word in their title.
+func (s *Search) wordGalleryIDs(word string) ([]int, error) {
+	firstNode, err := s.nodeByAddress("galleries", 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.searchNode("galleries", util.HashTerm(word), firstNode)
+	if errors.Is(err, errKeyNotFound) {
+		// word is not in the index
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.galleriesData(context.Background(), data)
+}
+
+// galleriesData returns gallery ids stored in galleries.data of galleriesindex.
+func (s *Search) galleriesData(ctx context.Context, data [2]int) ([]int, error) {
+	version, err := s.loadIndexVersion("galleriesindex")
+	if err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://ltn.hitomi.la/galleriesindex/galleries.%s.data", version), nil)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", data[0], data[0]+data[1]-1))
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("failed to get galleries data: %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeGalleriesData(content)
+}
@@ -0,0 +1,120 @@
+package hitomi
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+func TestSearch_Query(t *testing.T) {
+	h := stub.New()
+	h.SetNozomi("tag/female:big breasts-all.nozomi", 9, 8, 7, 6, 5, 4, 3, 2, 1)
+	h.SetNozomi("index-korean.nozomi", 9, 7, 5, 3, 1)
+	h.SetNozomi("tag/full color-all.nozomi", 7)
+	h.SetNozomi("index-all.nozomi", 10, 9, 8, 7, 6, 5, 4, 3, 2, 1)
+	s := NewSearch(DefaultOptions().WithClient(h.Client()))
+
+	result, err := s.Query("female:big_breasts  language:korean -tag:full_color")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.IDs, []int{9, 5, 3, 1}) || result.Total() != 4 {
+		t.Errorf("IDs = %v", result.IDs)
+	}
+	if got := result.Page(1, 3); !slices.Equal(got, []int{1}) {
+		t.Errorf("Page(1, 3) = %v", got)
+	}
+	if got := result.Page(2, 3); got != nil {
+		t.Errorf("Page(2, 3) = %v", got)
+	}
+
+	requests := len(h.Requests())
+	resumed, offset, err := s.Resume(result.Cursor(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed != result || offset != 3 {
+		t.Errorf("Resume = %v, %d", resumed, offset)
+	}
+	if n := len(h.Requests()) - requests; n != 1 {
+		t.Errorf("requests on resume = %d, want 1 (version check only)", n)
+	}
+
+	h.SetVersion("2")
+	if _, _, err := s.Resume(result.Cursor(3)); !errors.Is(err, ErrIndexChanged) {
+		t.Errorf("Resume after index changed: %v", err)
+	}
+
+	result, err = s.Query("-language:korean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.IDs, []int{10, 8, 6, 4, 2}) {
+		t.Errorf("IDs = %v", result.IDs)
+	}
+
+	result, err = s.Query("tag:full_color | -language:korean female:big_breasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.IDs, []int{8, 7, 6, 4, 2}) {
+		t.Errorf("IDs = %v", result.IDs)
+	}
+
+	if _, err := s.Query("colour:red"); err == nil {
+		t.Error("Query(invalid) succeeded")
+	}
+	if _, _, err := s.Resume("not a cursor"); err == nil {
+		t.Error("Resume(invalid) succeeded")
+	}
+	// indexes not recorded by Query are rejected without being fetched
+	requests = len(h.Requests())
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"q":"language:korean","v":{"tagindex":"1","../x":"1"}}`))
+	if _, _, err := s.Resume(forged); err == nil || len(h.Requests()) != requests {
+		t.Errorf("Resume(forged) = %v after %d requests", err, len(h.Requests())-requests)
+	}
+}
+
+func TestSearch_Query_ResultTTL(t *testing.T) {
+	h := stub.New()
+	h.SetNozomi("index-korean.nozomi", 3, 2, 1)
+	s := NewSearch(DefaultOptions().WithResultTTL(20 * time.Millisecond).WithClient(h.Client()))
+
+	if result, err := s.Query("language:korean"); err != nil || !slices.Equal(result.IDs, []int{3, 2, 1}) {
+		t.Fatalf("Query = %v, %v", result, err)
+	}
+	// a new gallery is added without index version changing
+	h.SetNozomi("index-korean.nozomi", 4, 3, 2, 1)
+	if result, err := s.Query("language:korean"); err != nil || !slices.Equal(result.IDs, []int{3, 2, 1}) {
+		t.Errorf("Query before ResultTTL = %v, %v", result, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if result, err := s.Query("language:korean"); err != nil || !slices.Equal(result.IDs, []int{4, 3, 2, 1}) {
+		t.Errorf("Query after ResultTTL = %v, %v", result, err)
+	}
+}
+
+func TestSearch_Query_TitleError(t *testing.T) {
+	root := encodeNode(nil, nil, []int{464})
+	h := stub.New()
+	h.Handle(func(req *http.Request) *http.Response {
+		if !strings.HasSuffix(req.URL.Path, ".index") {
+			return nil
+		}
+		if strings.HasPrefix(req.Header.Get("Range"), "bytes=0-") {
+			return stub.Response(200, string(root))
+		}
+		return stub.Response(503, "")
+	})
+	s := NewSearch(DefaultOptions().WithClient(h.Client()))
+	// failure of a sub node must not look like a word missing from the index
+	if result, err := s.Query("title"); err == nil {
+		t.Errorf("Query = %v, want error", result.IDs)
+	}
+}
@@ -1,16 +1,24 @@
 package hitomi
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/EINNN7/hitomi/internal/util"
 )
 
+// errKeyNotFound is returned when the key is not in the binary tree.
+var errKeyNotFound = errors.New("key not found")
+
 // MaxNodeSize is the maximum size of a binary tree node,
 // which is request chunk size.
 const MaxNodeSize = 464
@@ -21,6 +29,18 @@ type Search struct {
 
 	indexVersion map[string]string
 	indexCache   map[string][]byte
+
+	// mu guards indexVersion, indexCache, results and versionChecked.
+	mu      sync.Mutex
+	results []cachedResult
+	// versionChecked is when galleriesindex version was last fetched for Query.
+	versionChecked time.Time
+}
+
+// cachedResult is a result of Search.Query reused until expires.
+type cachedResult struct {
+	result  *SearchResult
+	expires time.Time
 }
 
 func NewSearch(options *Options) *Search {
@@ -48,149 +68,168 @@ func (s *Search) IndexVersion(name string) (string, error) {
 	return string(version), nil
 }
 
-// TagSuggestion returns tag suggestions for the query.
+// Refresh drops cached index versions, indexes and results,
+// so that following searches see the latest galleries.
+func (s *Search) Refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.indexVersion)
+	clear(s.indexCache)
+	s.results = nil
+	s.versionChecked = time.Time{}
+}
+
+// TagSuggestion returns tag suggestions for the query, sorted by Count.
 // The query must be in the form of "field:query".
-func (s *Search) TagSuggestion(query string) ([]string, error) {
-	field := strings.Split(query, ":")
-	if len(field) != 2 {
+func (s *Search) TagSuggestion(query string) ([]Suggestion, error) {
+	tag, err := ParseTag(query)
+	if err != nil {
 		return nil, fmt.Errorf("invalid query: %s", query)
 	}
-	firstNode, err := s.nodeByAddress(field[0], 0)
+	suggestions, err := s.suggestions(tag)
+	if err != nil {
+		return nil, err
+	}
+	sortSuggestions(suggestions)
+	return suggestions, nil
+}
+
+// Suggestion is a suggested tag with the number of galleries with the tag.
+// String returns the tag in the form of "namespace:name".
+type Suggestion struct {
+	Tag
+	Count int
+}
+
+// sortSuggestions sorts suggestions by Count, most first.
+func sortSuggestions(suggestions []Suggestion) {
+	slices.SortStableFunc(suggestions, func(a, b Suggestion) int {
+		return b.Count - a.Count
+	})
+}
+
+func (s *Search) suggestions(tag Tag) ([]Suggestion, error) {
+	field, key := tag.SuggestionKey()
+	firstNode, err := s.nodeByAddress(field, 0)
 	if err != nil {
 		return nil, err
 	}
-	dataOffset, err := s.searchNode(field[0], util.HashTerm(field[1]), firstNode)
+	dataOffset, err := s.searchNode(field, key, firstNode)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find search result: %w", err)
 	}
-	return s.tagSuggestionData(field[0], dataOffset)
+	return s.tagSuggestionData(field, dataOffset)
 }
 
-func (s *Search) tagSuggestionData(field string, data [2]int) ([]string, error) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://ltn.hitomi.la/tagindex/%s.%s.data", field, s.indexVersion["tagindex"]), nil)
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", data[0], data[0]+data[1]))
+// GalleryIDs returns ids of galleries with the tag, newest first.
+func (s *Search) GalleryIDs(tag Tag) ([]int, error) {
+	ids, _, err := s.nozomi(context.Background(), tag, 0, 0)
+	return ids, err
+}
+
+// GalleryIDsRange returns count ids of galleries with the tag from offset, newest first,
+// and total number of ids, requesting only the range needed.
+// total is -1 if the server did not report it.
+func (s *Search) GalleryIDsRange(ctx context.Context, tag Tag, offset, count int) ([]int, int, error) {
+	return s.nozomi(ctx, tag, offset, count)
+}
+
+// nozomi returns count ids of galleries with the tag from start, and total number of ids.
+// If count is 0, it returns all ids from start.
+// total is -1 if the server did not report it.
+func (s *Search) nozomi(ctx context.Context, tag Tag, start, count int) ([]int, int, error) {
+	u := url.URL{Scheme: "https", Host: "ltn.hitomi.la", Path: "/n/" + tag.NozomiPath()}
+	req, _ := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if count > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start*4, (start+count)*4-1))
+	} else if start > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start*4))
+	}
 	resp, err := s.options.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil, start, nil
+	}
+	if resp.StatusCode >= 400 {
+		return nil, 0, fmt.Errorf("failed to get nozomi: %d", resp.StatusCode)
+	}
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	var position = 4
-	suggestionLength := int32(binary.BigEndian.Uint32(content[0:4]))
-	var suggestions = make([]string, suggestionLength)
-	for i := int32(0); i < suggestionLength; i++ {
-		headerLength := int32(binary.BigEndian.Uint32(content[position : position+4]))
-		position += 4
-		header := string(content[position : position+int(headerLength)])
-		position += int(headerLength)
-		tagLength := int32(binary.BigEndian.Uint32(content[position : position+4]))
-		position += 4
-		tag := string(content[position : position+int(tagLength)])
-		position += int(tagLength) + 4
-		suggestions[i] = header + ":" + strings.ReplaceAll(tag, " ", "_")
+	ids, err := decodeNozomi(content)
+	if err != nil {
+		return nil, 0, err
 	}
-	return suggestions, nil
-}
-
-type node struct {
-	Key            [][]byte
-	Data           [][2]int
-	SubNodeAddress []int
-}
-
-func decodeNode(data []byte) (*node, error) {
-	node := new(node)
-	node.Key = [][]byte{}
-	node.Data = [][2]int{}
-	node.SubNodeAddress = []int{}
-
-	var pos int32 = 4
-	keyLength := int32(binary.BigEndian.Uint32(data[0:4]))
-
-	for i := int32(0); i < keyLength; i++ {
-		keySize := int32(binary.BigEndian.Uint32(data[pos : pos+4]))
-		if keySize == 0 || keySize > 32 {
-			return nil, fmt.Errorf("invalid key size: %d", keySize)
+	if resp.StatusCode != http.StatusPartialContent {
+		// server ignored range, so content is the whole file
+		total := len(ids)
+		ids = ids[min(start, total):]
+		if count > 0 {
+			ids = ids[:min(count, len(ids))]
 		}
-		pos += 4
-		node.Key = append(node.Key, data[pos:pos+keySize])
-		pos += keySize
+		return ids, total, nil
 	}
-
-	dataLength := int32(binary.BigEndian.Uint32(data[pos : pos+4]))
-	pos += 4
-
-	for i := int32(0); i < dataLength; i++ {
-		offset := int64(binary.BigEndian.Uint64(data[pos : pos+8]))
-		pos += 8
-
-		length := int32(binary.BigEndian.Uint32(data[pos : pos+4]))
-		pos += 4
-
-		node.Data = append(node.Data, [2]int{int(offset), int(length)})
+	total := -1
+	if _, size, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+		if v, err := strconv.Atoi(size); err == nil {
+			total = v / 4
+		}
 	}
+	return ids, total, nil
+}
 
-	for i := 0; i < 16+1; i++ {
-		subNodeAddress := binary.BigEndian.Uint64(data[pos : pos+8])
-		pos += 8
-		node.SubNodeAddress = append(node.SubNodeAddress, int(subNodeAddress))
+func (s *Search) tagSuggestionData(field string, data [2]int) ([]Suggestion, error) {
+	version, err := s.loadIndexVersion("tagindex")
+	if err != nil {
+		return nil, err
 	}
-
-	return node, nil
+	req, _ := http.NewRequest("GET", fmt.Sprintf("https://ltn.hitomi.la/tagindex/%s.%s.data", field, version), nil)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", data[0], data[0]+data[1]))
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("failed to get suggestion data: %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSuggestions(content)
 }
 
 func (s *Search) nodeByAddress(field string, address int) (*node, error) {
 	var url string
 	switch field {
-	case "galleries":
-		if _, ok := s.indexVersion["galleriesindex"]; !ok {
-			s.options.Logger.Debug().Msg("galleriesindex version not found, fetch fresh one")
-			version, err := s.IndexVersion("galleriesindex")
-			if err != nil {
-				return nil, err
-			}
-			s.indexVersion["galleriesindex"] = version
-		}
-		url = fmt.Sprintf("https://ltn.hitomi.la/galleriesindex/galleries.%s.index", s.indexVersion["galleriesindex"])
-	case "languages":
-		if _, ok := s.indexVersion["languagesindex"]; !ok {
-			s.options.Logger.Debug().Msg("languagesindex version not found, fetch fresh one")
-			version, err := s.IndexVersion("languagesindex")
-			if err != nil {
-				return nil, err
-			}
-			s.indexVersion["languagesindex"] = version
-		}
-		url = fmt.Sprintf("https://ltn.hitomi.la/languagesindex/languages.%s.index", s.indexVersion["languagesindex"])
-	case "nozomiurl":
-		if _, ok := s.indexVersion["nozomiurlindex"]; !ok {
-			s.options.Logger.Debug().Msg("nozomiurlindex version not found, fetch fresh one")
-			version, err := s.IndexVersion("nozomiurlindex")
-			if err != nil {
-				return nil, err
-			}
-			s.indexVersion["nozomiurlindex"] = version
-		}
-		url = fmt.Sprintf("https://ltn.hitomi.la/nozomiurlindex/nozomiurl.%s.index", s.indexVersion["nozomiurlindex"])
+	case "galleries", "languages", "nozomiurl":
+		version, err := s.loadIndexVersion(field + "index")
+		if err != nil {
+			return nil, err
+		}
+		url = fmt.Sprintf("https://ltn.hitomi.la/%sindex/%s.%s.index", field, field, version)
 	default:
-		if _, ok := s.indexVersion["tagindex"]; !ok {
-			s.options.Logger.Debug().Msg("tagindex version not found, fetch fresh one")
-			version, err := s.IndexVersion("tagindex")
-			if err != nil {
-				return nil, err
-			}
-			s.indexVersion["tagindex"] = version
+		version, err := s.loadIndexVersion("tagindex")
+		if err != nil {
+			return nil, err
 		}
-		url = fmt.Sprintf("https://ltn.hitomi.la/tagindex/%s.%s.index", field, s.indexVersion["tagindex"])
+		url = fmt.Sprintf("https://ltn.hitomi.la/tagindex/%s.%s.index", field, version)
 	}
 	if s.options.CacheWholeIndex {
-		if v, ok := s.indexCache[url]; ok {
-			return decodeNode(v[address : address+MaxNodeSize-1])
+		s.mu.Lock()
+		v, ok := s.indexCache[url]
+		s.mu.Unlock()
+		if ok {
+			return decodeNode(nodeSlice(v, address))
 		}
 		s.options.Logger.Debug().Msgf("indexCache for %s not found, fetch fresh one", url)
 		req, _ := http.NewRequest("GET", url, nil)
@@ -208,8 +247,10 @@ func (s *Search) nodeByAddress(field string, address int) (*node, error) {
 		if err != nil {
 			return nil, err
 		}
+		s.mu.Lock()
 		s.indexCache[url] = content
-		return decodeNode(content[address : address+MaxNodeSize-1])
+		s.mu.Unlock()
+		return decodeNode(nodeSlice(content, address))
 	} else {
 		req, _ := http.NewRequest("GET", url, nil)
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", address, address+MaxNodeSize-1))
@@ -231,6 +272,25 @@ func (s *Search) nodeByAddress(field string, address int) (*node, error) {
 	}
 }
 
+// loadIndexVersion returns the cached version of the index, fetching fresh one if it is not cached.
+func (s *Search) loadIndexVersion(name string) (string, error) {
+	s.mu.Lock()
+	version, ok := s.indexVersion[name]
+	s.mu.Unlock()
+	if ok {
+		return version, nil
+	}
+	s.options.Logger.Debug().Msgf("%s version not found, fetch fresh one", name)
+	version, err := s.IndexVersion(name)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.indexVersion[name] = version
+	s.mu.Unlock()
+	return version, nil
+}
+
 func (s *Search) searchNode(field string, key []byte, node *node) ([2]int, error) {
 	if node == nil {
 		return [2]int{}, fmt.Errorf("node is nil")
@@ -241,15 +301,52 @@ func (s *Search) searchNode(field string, key []byte, node *node) ([2]int, error
 		return node.Data[next], nil
 	} else {
 		if util.IsLeaf(node.SubNodeAddress) {
-			return [2]int{}, fmt.Errorf("latest leaf node")
+			return [2]int{}, fmt.Errorf("%w: latest leaf node", errKeyNotFound)
 		}
 	}
 	if node.SubNodeAddress[next] == 0 {
-		return [2]int{}, fmt.Errorf("non-root node address 0")
+		return [2]int{}, fmt.Errorf("%w: non-root node address 0", errKeyNotFound)
 	}
 	subNode, err := s.nodeByAddress(field, node.SubNodeAddress[next])
 	if err != nil {
-		return [2]int{}, fmt.Errorf("failed to retrive subNode %d", next)
+		return [2]int{}, fmt.Errorf("failed to retrieve sub node %d at %d: %w", next, node.SubNodeAddress[next], err)
 	}
 	return s.searchNode(field, key, subNode)
 }
+
+// SortByPublished sorts galleries by published date.
+func SortByPublished(galleries []*Gallery, newestFirst bool) {
+	slices.SortStableFunc(galleries, func(a, b *Gallery) int {
+		if newestFirst {
+			return b.Published.Compare(a.Published)
+		}
+		return a.Published.Compare(b.Published)
+	})
+}
+
+// FilterByType returns galleries whose type is one of types.
+func FilterByType(galleries []*Gallery, types ...GalleryType) []*Gallery {
+	var result []*Gallery
+	for _, gallery := range galleries {
+		if slices.Contains(types, gallery.Type) {
+			result = append(result, gallery)
+		}
+	}
+	return result
+}
+
+// FilterByPublished returns galleries published in [from, to).
+// Zero from or to means no bound.
+func FilterByPublished(galleries []*Gallery, from, to time.Time) []*Gallery {
+	var result []*Gallery
+	for _, gallery := range galleries {
+		if !from.IsZero() && gallery.Published.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !gallery.Published.Before(to) {
+			continue
+		}
+		result = append(result, gallery)
+	}
+	return result
+}
@@ -23,6 +23,14 @@ func TestSearch_TagSuggestion_CacheWholeIndex(t *testing.T) {
 	t.Log(result)
 }
 
+func TestSearch_GalleryIDs(t *testing.T) {
+	result, err := search.GalleryIDs(Tag{Namespace: NamespaceFemale, Name: "big breasts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(len(result))
+}
+
 func BenchmarkSearch_TagSuggestion_CacheWholeIndex(b *testing.B) {
 	b.StopTimer()
 	csc := NewSearch(DefaultOptions().WithCacheWholeIndex(true))
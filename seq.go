@@ -0,0 +1,113 @@
+package hitomi
+
+import (
+	"context"
+	"iter"
+	"slices"
+)
+
+// NozomiPageSize is the number of ids fetched at once by GalleryIDsSeq.
+const NozomiPageSize = 1000
+
+// GalleryIDsSeq returns an iterator over ids of galleries with the tag, newest first.
+// ids are fetched page by page using range requests as the iteration proceeds,
+// so stopping early does not download the rest of the nozomi file.
+// Use Tag{Namespace: NamespaceLanguage, Name: "all"} to iterate over every gallery.
+func (s *Search) GalleryIDsSeq(ctx context.Context, tag Tag) iter.Seq2[int, error] {
+	return func(yield func(int, error) bool) {
+		for start := 0; ; start += NozomiPageSize {
+			ids, total, err := s.nozomi(ctx, tag, start, NozomiPageSize)
+			if err != nil {
+				yield(0, err)
+				return
+			}
+			for _, id := range ids {
+				if !yield(id, nil) {
+					return
+				}
+			}
+			if len(ids) < NozomiPageSize || (total >= 0 && start+len(ids) >= total) {
+				return
+			}
+		}
+	}
+}
+
+// Galleries returns an iterator over galleries with the tag, newest first.
+// It is a shorthand for GalleryIDsSeq and Client.GalleriesSeq.
+func (s *Search) Galleries(ctx context.Context, client *Client, tag Tag, opts *BatchOptions) iter.Seq2[*Gallery, error] {
+	return client.galleriesSeq(ctx, s.GalleryIDsSeq(ctx, tag), opts)
+}
+
+// GalleriesSeq returns an iterator over galleries of ids, in the order of ids.
+// ids are pulled and fetched concurrently in chunks of opts.Concurrency as the iteration proceeds.
+// opts.Ordered is ignored.
+func (c *Client) GalleriesSeq(ctx context.Context, ids iter.Seq[int], opts *BatchOptions) iter.Seq2[*Gallery, error] {
+	return c.galleriesSeq(ctx, func(yield func(int, error) bool) {
+		for id := range ids {
+			if !yield(id, nil) {
+				return
+			}
+		}
+	}, opts)
+}
+
+func (c *Client) galleriesSeq(ctx context.Context, ids iter.Seq2[int, error], opts *BatchOptions) iter.Seq2[*Gallery, error] {
+	if opts == nil {
+		opts = DefaultBatchOptions()
+	}
+	chunkOpts := *opts
+	chunkOpts.Ordered = true
+	chunkSize := max(opts.Concurrency, 1)
+
+	return func(yield func(*Gallery, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// flush fetches chunk and yields results, reporting whether to continue.
+		flush := func(chunk []int) bool {
+			for result := range c.Galleries(ctx, chunk, &chunkOpts) {
+				if !yield(result.Gallery, result.Err) {
+					return false
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return false
+			}
+			return true
+		}
+
+		chunk := make([]int, 0, chunkSize)
+		for id, err := range ids {
+			if err != nil {
+				if flush(chunk) {
+					yield(nil, err)
+				}
+				return
+			}
+			chunk = append(chunk, id)
+			if len(chunk) == chunkSize {
+				if !flush(slices.Clone(chunk)) {
+					return
+				}
+				chunk = chunk[:0]
+			}
+		}
+		flush(chunk)
+	}
+}
+
+// FilesSeq returns an iterator over file contents of gallery, in the order of Gallery.Files.
+// Each file is downloaded when the iteration reaches it.
+func (c *Client) FilesSeq(ctx context.Context, gallery *Gallery) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for _, file := range gallery.Files {
+			req := c.FileRequest(c.FileURL(file.Hash), gallery.Id).WithContext(ctx)
+			content, err := c.fileContent(req)
+			if !yield(content, err) || err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package hitomi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+func TestSearch_GalleryIDsSeq(t *testing.T) {
+	ids := make([]int, NozomiPageSize*2+10)
+	for i := range ids {
+		ids[i] = len(ids) - i
+	}
+	h := stub.New()
+	h.SetNozomi("index-all.nozomi", ids...)
+	s := NewSearch(DefaultOptions().WithClient(h.Client()))
+
+	var got []int
+	for id, err := range s.GalleryIDsSeq(context.Background(), Tag{Namespace: NamespaceLanguage, Name: "all"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id)
+	}
+	if !slices.Equal(got, ids) {
+		t.Errorf("got %d ids, want %d", len(got), len(ids))
+	}
+	if n := len(h.Requests()); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+
+	requests := len(h.Requests())
+	for range s.GalleryIDsSeq(context.Background(), Tag{Namespace: NamespaceLanguage, Name: "all"}) {
+		break
+	}
+	if n := len(h.Requests()) - requests; n != 1 {
+		t.Errorf("requests after early stop = %d, want 1", n)
+	}
+}
+
+func TestClient_GalleriesSeq(t *testing.T) {
+	var requests, inflight, maxInflight int32
+	c := NewClient(DefaultOptions().WithClient(galleryServer(&requests, &inflight, &maxInflight)))
+	ids := []int{5, 4, 404, 2, 1}
+
+	var got []string
+	var failed int
+	for gallery, err := range c.GalleriesSeq(context.Background(), slices.Values(ids), DefaultBatchOptions().WithConcurrency(2)) {
+		if err != nil {
+			failed++
+			continue
+		}
+		got = append(got, gallery.Id)
+	}
+	if fmt.Sprint(got) != "[5 4 2 1]" || failed != 1 {
+		t.Errorf("got %v with %d failures", got, failed)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	for range c.GalleriesSeq(context.Background(), slices.Values(ids), DefaultBatchOptions().WithConcurrency(2)) {
+		break
+	}
+	if n := atomic.LoadInt32(&requests); n > 2 {
+		t.Errorf("requests after early stop = %d, want <= 2", n)
+	}
+}
+
+func TestClient_FilesSeq(t *testing.T) {
+	c := NewClient(DefaultOptions().WithClient(stub.Client(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/gg.js" {
+			return stub.Response(200, "case 1: case 2: o = 1; break; b: '1700000000/'")
+		}
+		return stub.Response(200, req.URL.Path)
+	})))
+	if err := c.UpdateScript(); err != nil {
+		t.Fatal(err)
+	}
+	gallery := &Gallery{Id: "1"}
+	for _, hash := range []string{strings.Repeat("a", 64), strings.Repeat("b", 64)} {
+		gallery.Files = append(gallery.Files, struct {
+			HasJXL  bool
+			HasAVIF bool
+			HasWEBP bool
+			Width   int
+			Height  int
+			Name    string
+			Hash    string
+			Single  bool
+		}{Hash: hash})
+	}
+	var n int
+	for content, err := range c.FilesSeq(context.Background(), gallery) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), gallery.Files[n].Hash) {
+			t.Errorf("file %d = %q", n, content)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("got %d files", n)
+	}
+}
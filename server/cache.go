@@ -0,0 +1,216 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FileCache is an on-disk store of files addressed by their hash,
+// evicting least recently used files when it grows over its maximum size.
+// Concurrent fetches of the same hash are coalesced into one.
+// It is safe for concurrent use.
+type FileCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*cacheEntry
+	calls   map[string]*cacheCall
+}
+
+type cacheEntry struct {
+	size int64
+	used time.Time
+}
+
+// cacheCall is a fetch in flight.
+type cacheCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewFileCache returns a cache storing files in dir up to maxSize bytes,
+// picking up files stored by previous runs.
+func NewFileCache(dir string, maxSize int64) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &FileCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: map[string]*cacheEntry{},
+		calls:   map[string]*cacheCall{},
+	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if !hashPattern.MatchString(name) || path != c.path(name) {
+			// leftover temporary file of interrupted fetch
+			_ = os.Remove(path)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		c.entries[name] = &cacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// path returns path of file of hash, spread over subdirectories to keep directories small.
+func (c *FileCache) path(hash string) string {
+	return filepath.Join(c.dir, hash[len(hash)-2:], hash)
+}
+
+// Size returns the total size of cached files.
+func (c *FileCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Open opens cached file of hash, reporting whether it is cached.
+func (c *FileCache) Open(hash string) (*os.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.open(hash)
+}
+
+// open must be called with c.mu held.
+func (c *FileCache) open(hash string) (*os.File, bool) {
+	entry, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(c.path(hash))
+	if err != nil {
+		// removed behind our back
+		c.size -= entry.size
+		delete(c.entries, hash)
+		return nil, false
+	}
+	entry.used = time.Now()
+	return f, true
+}
+
+// Fetch opens cached file of hash, calling fetch to write its content into the cache if it is not cached.
+// Callers fetching the same hash at the same time wait for one fetch and share its result.
+func (c *FileCache) Fetch(hash string, fetch func(w io.Writer) error) (*os.File, error) {
+	if !hashPattern.MatchString(hash) {
+		return nil, errors.New("invalid hash: " + hash)
+	}
+	c.mu.Lock()
+	if f, ok := c.open(hash); ok {
+		c.mu.Unlock()
+		return f, nil
+	}
+	if call, ok := c.calls[hash]; ok {
+		c.mu.Unlock()
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		if f, ok := c.Open(hash); ok {
+			return f, nil
+		}
+		// evicted right after the fetch, so fetch again
+		return c.Fetch(hash, fetch)
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[hash] = call
+	c.mu.Unlock()
+
+	size, err := c.store(hash, fetch)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.calls, hash)
+	call.err = err
+	close(call.done)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[hash] = &cacheEntry{size: size, used: time.Now()}
+	c.size += size
+	f, ok := c.open(hash)
+	c.evict()
+	if !ok {
+		return nil, errors.New("cached file disappeared: " + hash)
+	}
+	return f, nil
+}
+
+// store writes content of fetch into file of hash, returning its size.
+func (c *FileCache) store(hash string, fetch func(w io.Writer) error) (int64, error) {
+	path := c.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	// write to temporary file first so that a failed fetch never leaves a broken file
+	f, err := os.CreateTemp(filepath.Dir(path), ".fetch-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	if err := fetch(f); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// evict removes least recently used files until the cache fits in maxSize.
+// It must be called with c.mu held.
+func (c *FileCache) evict() {
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+	hashes := make([]string, 0, len(c.entries))
+	for hash := range c.entries {
+		hashes = append(hashes, hash)
+	}
+	slices.SortFunc(hashes, func(a, b string) int {
+		return c.entries[a].used.Compare(c.entries[b].used)
+	})
+	for _, hash := range hashes {
+		if c.size <= c.maxSize {
+			break
+		}
+		// files being served stay readable after removal
+		if err := os.Remove(c.path(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		c.size -= c.entries[hash].size
+		delete(c.entries, hash)
+	}
+}
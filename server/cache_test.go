@@ -0,0 +1,159 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+func testHashOf(i int) string {
+	return fmt.Sprintf("%064x", i)
+}
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewFileCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch := func(content string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+	read := func(f *os.File, err error) string {
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func(f *os.File) {
+			_ = f.Close()
+		}(f)
+		content, _ := io.ReadAll(f)
+		return string(content)
+	}
+
+	if got := read(c.Fetch(testHashOf(1), fetch("1234"))); got != "1234" {
+		t.Errorf("Fetch = %q", got)
+	}
+	// cached files are not fetched again
+	if got := read(c.Fetch(testHashOf(1), fetch("other"))); got != "1234" {
+		t.Errorf("Fetch cached = %q", got)
+	}
+	if _, err := c.Fetch(testHashOf(2), func(w io.Writer) error { return errors.New("failed") }); err == nil {
+		t.Error("Fetch did not fail")
+	}
+	if _, ok := c.Open(testHashOf(2)); ok {
+		t.Error("failed fetch is cached")
+	}
+
+	time.Sleep(time.Millisecond)
+	read(c.Fetch(testHashOf(2), fetch("5678")))
+	time.Sleep(time.Millisecond)
+	// 1 is used more recently than 2, so 2 is evicted
+	read(c.Fetch(testHashOf(1), nil))
+	time.Sleep(time.Millisecond)
+	read(c.Fetch(testHashOf(3), fetch("901")))
+	if _, ok := c.Open(testHashOf(2)); ok || c.Size() != 7 {
+		t.Errorf("after eviction: cached 2 = %v, size = %d", ok, c.Size())
+	}
+
+	c, err = NewFileCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Open(testHashOf(3)); got == nil || c.Size() != 7 {
+		t.Errorf("reopened cache lost files, size = %d", c.Size())
+	} else {
+		_ = got.Close()
+	}
+}
+
+func TestFileCache_Coalesce(t *testing.T) {
+	c, err := NewFileCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := c.Fetch(testHashOf(1), func(w io.Writer) error {
+				fetches.Add(1)
+				<-release
+				_, err := io.WriteString(w, "content")
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = f.Close()
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times", n)
+	}
+}
+
+func TestHandler_CachedFile(t *testing.T) {
+	var fetches atomic.Int32
+	h := stub.New()
+	h.SetFile(testHash, "image")
+	h.Handle(func(req *http.Request) *http.Response {
+		if req.URL.Path != "/gg.js" {
+			fetches.Add(1)
+		}
+		return nil
+	})
+	cache, err := NewFileCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(New(hitomi.DefaultOptions().WithClient(h.Client()), DefaultOptions().WithCache(cache)))
+	defer server.Close()
+
+	for range 2 {
+		resp, err := http.Get(server.URL + "/file/" + testHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != 200 || string(body) != "image" || resp.Header.Get("ETag") != `"`+testHash+`"` ||
+			!strings.Contains(resp.Header.Get("Cache-Control"), "immutable") {
+			t.Errorf("/file = %d, %q, %v", resp.StatusCode, body, resp.Header)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times", n)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/file/"+testHash, nil)
+	req.Header.Set("If-None-Match", `"`+testHash+`"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d", resp.StatusCode)
+	}
+}
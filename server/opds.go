@@ -0,0 +1,537 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/export"
+	"github.com/EINNN7/hitomi/library"
+)
+
+// OPDS catalog endpoints:
+//
+//	GET /opds                            OPDS 1.2 navigation feed
+//	GET /opds/search?q=&page=            OPDS 1.2 acquisition feed of galleries matching query
+//	GET /opds/popular/{period}?page=     OPDS 1.2 acquisition feed of popular galleries, without Options.Library
+//	GET /opds/opensearch.xml             OpenSearch description of /opds/search
+//	GET /opds/v2                         OPDS 2.0 navigation feed
+//	GET /opds/v2/search?q=&page=         OPDS 2.0 publications feed of galleries matching query
+//	GET /opds/cbz/{id}                   gallery as cbz archive, streamed as it is downloaded
+//
+// Feeds list galleries of Options.Library if it is set, otherwise live search results.
+// Covers link to /file/{hash} and thumbnails to /thumbnail/{hash}, so that readers can load them without the Referer hitomi requires.
+
+const (
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsJSONType        = "application/opds+json"
+	openSearchType      = "application/opensearchdescription+xml"
+	cbzType             = "application/vnd.comicbook+zip"
+)
+
+func (h *Handler) handleOPDS() {
+	h.mux.HandleFunc("GET /opds", h.opdsNavigation)
+	h.mux.HandleFunc("GET /opds/search", h.opdsSearch)
+	h.mux.HandleFunc("GET /opds/popular/{period}", h.opdsPopular)
+	h.mux.HandleFunc("GET /opds/opensearch.xml", h.opdsOpenSearch)
+	h.mux.HandleFunc("GET /opds/v2", h.opdsNavigationV2)
+	h.mux.HandleFunc("GET /opds/v2/search", h.opdsSearchV2)
+	h.mux.HandleFunc("GET /opds/cbz/{id}", h.opdsCBZ)
+}
+
+type atomFeed struct {
+	XMLName         xml.Name    `xml:"feed"`
+	Xmlns           string      `xml:"xmlns,attr"`
+	XmlnsDC         string      `xml:"xmlns:dc,attr"`
+	XmlnsOPDS       string      `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string      `xml:"xmlns:opensearch,attr"`
+	ID              string      `xml:"id"`
+	Title           string      `xml:"title"`
+	Updated         string      `xml:"updated"`
+	TotalResults    int         `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    int         `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      int         `xml:"opensearch:startIndex,omitempty"`
+	Links           []atomLink  `xml:"link"`
+	Entries         []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomContent   `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// newAtomFeed returns feed with namespaces and links shared by every feed.
+func (h *Handler) newAtomFeed(id, title, self, kind string) *atomFeed {
+	return &atomFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOPDS:       "http://opds-spec.org/2010/catalog",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		ID:              id,
+		Title:           title,
+		Updated:         time.Now().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: self, Type: kind},
+			{Rel: "start", Href: h.opts.BaseURL + "/opds", Type: opdsNavigationType},
+			{Rel: "search", Href: h.opts.BaseURL + "/opds/opensearch.xml", Type: openSearchType},
+		},
+	}
+}
+
+func writeXML(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType+";charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+func (h *Handler) opdsNavigation(w http.ResponseWriter, r *http.Request) {
+	feed := h.newAtomFeed("urn:hitomi:root", h.catalogTitle(), h.opts.BaseURL+"/opds", opdsNavigationType)
+	for _, item := range h.navigationItems() {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      "urn:hitomi:" + item.id,
+			Title:   item.title,
+			Updated: feed.Updated,
+			Content: &atomContent{Type: "text", Text: item.title},
+			Links:   []atomLink{{Rel: "subsection", Href: item.href, Type: opdsAcquisitionType}},
+		})
+	}
+	writeXML(w, opdsNavigationType, feed)
+}
+
+// catalogTitle returns title of catalog.
+func (h *Handler) catalogTitle() string {
+	if h.opts.Library != nil {
+		return "hitomi library"
+	}
+	return "hitomi"
+}
+
+type navigationItem struct {
+	id, title, href string
+}
+
+// navigationItems returns items of navigation feeds, linking to OPDS 1.2 feeds.
+func (h *Handler) navigationItems() []navigationItem {
+	items := []navigationItem{{id: "all", title: "All galleries", href: h.opts.BaseURL + "/opds/search"}}
+	if h.opts.Library != nil {
+		return items
+	}
+	for _, period := range hitomi.PopularPeriods {
+		items = append(items, navigationItem{
+			id:    "popular:" + period,
+			title: "Popular " + period,
+			href:  h.opts.BaseURL + "/opds/popular/" + period,
+		})
+	}
+	return items
+}
+
+func (h *Handler) opdsOpenSearch(w http.ResponseWriter, r *http.Request) {
+	writeXML(w, openSearchType, struct {
+		XMLName     xml.Name `xml:"OpenSearchDescription"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		ShortName   string   `xml:"ShortName"`
+		Description string   `xml:"Description"`
+		URL         struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		} `xml:"Url"`
+	}{
+		Xmlns:       "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:   h.catalogTitle(),
+		Description: "Search galleries, like female:glasses language:english",
+		URL: struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		}{opdsAcquisitionType, h.opts.BaseURL + "/opds/search?q={searchTerms}"},
+	})
+}
+
+// feedPage is a page of galleries listed by a feed.
+type feedPage struct {
+	galleries    []*hitomi.Gallery
+	total        int
+	offset, size int
+}
+
+// searchPage returns galleries of page requested by r.
+func (h *Handler) searchPage(r *http.Request) (*feedPage, int, error) {
+	offset, size, err := h.page(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	query := r.FormValue("q")
+	page := &feedPage{offset: offset, size: size}
+	if h.opts.Library != nil {
+		entries, err := h.opts.Library.Search(query)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		var galleries []*hitomi.Gallery
+		for _, entry := range entries {
+			if h.check(entry.Gallery) == nil {
+				galleries = append(galleries, entry.Gallery)
+			}
+		}
+		page.total = len(galleries)
+		page.galleries = galleries[min(offset, len(galleries)):min(offset+size, len(galleries))]
+		return page, 0, nil
+	}
+	result, err := h.search.Query(h.opts.Filter.Query(query))
+	var queryErr *hitomi.QueryError
+	if errors.As(err, &queryErr) {
+		return nil, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	page.total = result.Total()
+	page.galleries = h.galleries(r.Context(), result.Range(offset, size))
+	return page, 0, nil
+}
+
+// galleries fetches galleries of ids in order, leaving out ones which failed to fetch or are excluded by Options.Filter.
+func (h *Handler) galleries(ctx context.Context, ids []int) []*hitomi.Gallery {
+	var galleries []*hitomi.Gallery
+	opts := hitomi.DefaultBatchOptions().WithOrdered(true).WithFilter(h.opts.Filter)
+	for result := range h.client.Galleries(ctx, ids, opts) {
+		if errors.Is(result.Err, hitomi.ErrExcluded) {
+			continue
+		}
+		if result.Err != nil {
+			h.options.Logger.Warn().Err(result.Err).Int("id", result.Id).Msg("failed to get gallery for feed")
+			continue
+		}
+		galleries = append(galleries, result.Gallery)
+	}
+	return galleries
+}
+
+// links returns links to previous and next pages of page, whose first page is at base.
+func (page *feedPage) links(base string, kind string) []atomLink {
+	var links []atomLink
+	if page.offset > 0 {
+		links = append(links, atomLink{Rel: "previous", Href: withPage(base, page.offset/page.size-1), Type: kind})
+	}
+	if page.offset+page.size < page.total {
+		links = append(links, atomLink{Rel: "next", Href: withPage(base, page.offset/page.size+1), Type: kind})
+	}
+	return links
+}
+
+// withPage returns u with page query parameter set.
+func withPage(u string, page int) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	q := parsed.Query()
+	q.Set("page", strconv.Itoa(page))
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+func (h *Handler) opdsSearch(w http.ResponseWriter, r *http.Request) {
+	page, status, err := h.searchPage(r)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	query := r.FormValue("q")
+	self := h.opts.BaseURL + "/opds/search?q=" + url.QueryEscape(query)
+	title := "All galleries"
+	if query != "" {
+		title = "Search: " + query
+	}
+	h.writeAcquisitionFeed(w, "urn:hitomi:search:"+query, title, self, page)
+}
+
+func (h *Handler) opdsPopular(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Library != nil {
+		writeError(w, http.StatusNotFound, errors.New("popular galleries are not in library"))
+		return
+	}
+	tag, err := hitomi.PopularTag(r.PathValue("period"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	offset, size, err := h.page(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ids, total, err := h.popularIDs(r.Context(), tag, offset, size)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	page := &feedPage{
+		galleries: h.galleries(r.Context(), ids),
+		total:     total,
+		offset:    offset,
+		size:      size,
+	}
+	h.writeAcquisitionFeed(w, "urn:hitomi:popular:"+tag.Name, "Popular "+tag.Name, h.opts.BaseURL+"/opds/popular/"+tag.Name, page)
+}
+
+func (h *Handler) writeAcquisitionFeed(w http.ResponseWriter, id, title, self string, page *feedPage) {
+	feed := h.newAtomFeed(id, title, self, opdsAcquisitionType)
+	feed.TotalResults = page.total
+	feed.ItemsPerPage = page.size
+	feed.StartIndex = page.offset + 1
+	feed.Links = append(feed.Links, page.links(self, opdsAcquisitionType)...)
+	for _, g := range page.galleries {
+		feed.Entries = append(feed.Entries, h.atomEntry(g))
+	}
+	writeXML(w, opdsAcquisitionType, feed)
+}
+
+// coverURL returns url of the first page of gallery through the file proxy, or empty if it has no pages.
+func (h *Handler) coverURL(g *hitomi.Gallery) string {
+	if len(g.Files) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/file/%s?gallery=%s", h.opts.BaseURL, g.Files[0].Hash, url.QueryEscape(g.Id))
+}
+
+// thumbnailURL returns url of the thumbnail of the first page of gallery through the proxy, or empty if it has no pages.
+func (h *Handler) thumbnailURL(g *hitomi.Gallery) string {
+	if len(g.Files) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/thumbnail/%s?gallery=%s", h.opts.BaseURL, g.Files[0].Hash, url.QueryEscape(g.Id))
+}
+
+func (h *Handler) cbzURL(g *hitomi.Gallery) string {
+	return h.opts.BaseURL + "/opds/cbz/" + url.PathEscape(g.Id)
+}
+
+func (h *Handler) atomEntry(g *hitomi.Gallery) atomEntry {
+	entry := atomEntry{
+		ID:       "urn:hitomi:" + g.Id,
+		Title:    g.Title,
+		Updated:  time.Now().UTC().Format(time.RFC3339),
+		Language: g.Language,
+		Content:  &atomContent{Type: "text", Text: fmt.Sprintf("%s, %d pages", g.Type, len(g.Files))},
+		Links:    []atomLink{{Rel: "http://opds-spec.org/acquisition", Href: h.cbzURL(g), Type: cbzType}},
+	}
+	if !g.Published.IsZero() {
+		entry.Updated = g.Published.UTC().Format(time.RFC3339)
+		entry.Issued = g.Published.Format("2006-01-02")
+	}
+	for _, a := range g.Artists {
+		entry.Authors = append(entry.Authors, atomAuthor{Name: a.Artist})
+	}
+	for _, tag := range g.Tags {
+		entry.Categories = append(entry.Categories, atomCategory{Term: tag.String(), Label: tag.Name})
+	}
+	if cover := h.coverURL(g); cover != "" {
+		entry.Links = append(entry.Links,
+			atomLink{Rel: "http://opds-spec.org/image", Href: cover, Type: "image/webp"},
+			atomLink{Rel: "http://opds-spec.org/image/thumbnail", Href: h.thumbnailURL(g), Type: "image/webp"},
+		)
+	}
+	return entry
+}
+
+// OPDS 2.0
+
+type opds2Feed struct {
+	Metadata     opds2FeedMetadata  `json:"metadata"`
+	Links        []opds2Link        `json:"links"`
+	Navigation   []opds2Link        `json:"navigation,omitempty"`
+	Publications []opds2Publication `json:"publications,omitempty"`
+}
+
+type opds2FeedMetadata struct {
+	Title         string `json:"title"`
+	NumberOfItems int    `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+type opds2Link struct {
+	Rel       string `json:"rel,omitempty"`
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+type opds2Publication struct {
+	Metadata opds2Metadata `json:"metadata"`
+	Links    []opds2Link   `json:"links"`
+	Images   []opds2Link   `json:"images,omitempty"`
+}
+
+type opds2Metadata struct {
+	Type       string   `json:"@type"`
+	Identifier string   `json:"identifier"`
+	Title      string   `json:"title"`
+	Author     []string `json:"author,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	Published  string   `json:"published,omitempty"`
+	Subject    []string `json:"subject,omitempty"`
+}
+
+func writeOPDS2(w http.ResponseWriter, feed *opds2Feed) {
+	w.Header().Set("Content-Type", opdsJSONType)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(feed)
+}
+
+// opds2Links returns links shared by every OPDS 2.0 feed.
+func (h *Handler) opds2Links(self string) []opds2Link {
+	return []opds2Link{
+		{Rel: "self", Href: self, Type: opdsJSONType},
+		{Rel: "start", Href: h.opts.BaseURL + "/opds/v2", Type: opdsJSONType},
+		{Rel: "search", Href: h.opts.BaseURL + "/opds/v2/search{?q}", Type: opdsJSONType, Templated: true},
+	}
+}
+
+func (h *Handler) opdsNavigationV2(w http.ResponseWriter, r *http.Request) {
+	feed := &opds2Feed{
+		Metadata:   opds2FeedMetadata{Title: h.catalogTitle()},
+		Links:      h.opds2Links(h.opts.BaseURL + "/opds/v2"),
+		Navigation: []opds2Link{{Href: h.opts.BaseURL + "/opds/v2/search", Type: opdsJSONType, Title: "All galleries"}},
+	}
+	writeOPDS2(w, feed)
+}
+
+func (h *Handler) opdsSearchV2(w http.ResponseWriter, r *http.Request) {
+	page, status, err := h.searchPage(r)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	query := r.FormValue("q")
+	self := h.opts.BaseURL + "/opds/v2/search?q=" + url.QueryEscape(query)
+	feed := &opds2Feed{
+		Metadata: opds2FeedMetadata{
+			Title:         "All galleries",
+			NumberOfItems: page.total,
+			ItemsPerPage:  page.size,
+			CurrentPage:   page.offset/page.size + 1,
+		},
+		Links:        h.opds2Links(self),
+		Publications: []opds2Publication{},
+	}
+	if query != "" {
+		feed.Metadata.Title = "Search: " + query
+	}
+	for _, link := range page.links(self, opdsJSONType) {
+		feed.Links = append(feed.Links, opds2Link{Rel: link.Rel, Href: link.Href, Type: link.Type})
+	}
+	for _, g := range page.galleries {
+		feed.Publications = append(feed.Publications, h.opds2Publication(g))
+	}
+	writeOPDS2(w, feed)
+}
+
+func (h *Handler) opds2Publication(g *hitomi.Gallery) opds2Publication {
+	p := opds2Publication{
+		Metadata: opds2Metadata{
+			Type:       "http://schema.org/Book",
+			Identifier: "urn:hitomi:" + g.Id,
+			Title:      g.Title,
+			Language:   g.Language,
+		},
+		Links: []opds2Link{{Rel: "http://opds-spec.org/acquisition/open-access", Href: h.cbzURL(g), Type: cbzType}},
+	}
+	if !g.Published.IsZero() {
+		p.Metadata.Published = g.Published.Format(time.RFC3339)
+	}
+	for _, a := range g.Artists {
+		p.Metadata.Author = append(p.Metadata.Author, a.Artist)
+	}
+	for _, tag := range g.Tags {
+		p.Metadata.Subject = append(p.Metadata.Subject, tag.String())
+	}
+	if cover := h.coverURL(g); cover != "" {
+		p.Images = []opds2Link{{Href: cover, Type: "image/webp"}}
+	}
+	return p
+}
+
+func (h *Handler) opdsCBZ(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid id: "+r.PathValue("id")))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%d.cbz"`, id))
+	if h.opts.Library != nil {
+		// serve downloaded archive as is, so that it works even if the gallery is gone
+		if entry, ok := h.opts.Library.Get(id); ok && entry.Format == library.FormatCBZ && len(entry.Files) == 1 {
+			if err := h.check(entry.Gallery); err != nil {
+				writeError(w, http.StatusForbidden, err)
+				return
+			}
+			w.Header().Set("Content-Type", cbzType)
+			http.ServeFile(w, r, entry.Files[0].Path)
+			return
+		}
+	}
+	g, err := h.client.GalleryContext(r.Context(), strconv.Itoa(id))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if err := h.check(g); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	// gg.js is needed for every page, so fail before the archive is partly sent
+	if len(g.Files) > 0 {
+		if _, err := h.fileURL(g.Files[0].Hash); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", cbzType)
+	if err := export.CBZ(r.Context(), h.client, g, w, nil); err != nil {
+		// the archive is partly sent, so abort the response to let the reader know it is broken
+		h.options.Logger.Warn().Err(err).Int("id", id).Msg("failed to stream cbz")
+		panic(http.ErrAbortHandler)
+	}
+}
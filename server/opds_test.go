@@ -0,0 +1,171 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/library"
+)
+
+func read(t *testing.T, url string) (*http.Response, []byte) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestOPDS_Library(t *testing.T) {
+	dir := t.TempDir()
+	l, err := library.Open(filepath.Join(dir, "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		g := new(hitomi.Gallery)
+		script := `{"Id": "` + id + `", "Title": "gallery ` + id + `", "Language": "korean",
+			"Artists": [{"Artist": "alice"}], "Tags": [{"Namespace": "female", "Name": "glasses"}],
+			"Files": [{"Hash": "` + testHash + `"}]}`
+		if err := json.Unmarshal([]byte(script), g); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, id+".cbz")
+		if err := os.WriteFile(path, []byte("archive "+id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := library.NewEntry(g, library.FormatCBZ, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := DefaultOptions().WithLibrary(l).WithDefaultPageSize(2).WithBaseURL("http://example.com/hitomi/")
+	server := httptest.NewServer(New(hitomi.DefaultOptions(), opts))
+	defer server.Close()
+
+	resp, body := read(t, server.URL+"/opds")
+	if !strings.Contains(resp.Header.Get("Content-Type"), "kind=navigation") || !strings.Contains(string(body), `href="http://example.com/hitomi/opds/search"`) {
+		t.Errorf("/opds = %s", body)
+	}
+
+	resp, body = read(t, server.URL+"/opds/search?q=female:glasses")
+	var feed atomFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].ID != "urn:hitomi:3" || feed.Entries[0].Authors[0].Name != "alice" {
+		t.Errorf("entries = %+v", feed.Entries)
+	}
+	var links []string
+	for _, link := range feed.Entries[0].Links {
+		links = append(links, link.Rel+" "+link.Href)
+	}
+	if want := "http://opds-spec.org/acquisition http://example.com/hitomi/opds/cbz/3," +
+		"http://opds-spec.org/image http://example.com/hitomi/file/" + testHash + "?gallery=3," +
+		"http://opds-spec.org/image/thumbnail http://example.com/hitomi/thumbnail/" + testHash + "?gallery=3"; !strings.HasPrefix(strings.Join(links, ","), want) {
+		t.Errorf("links = %v", links)
+	}
+	var next string
+	for _, link := range feed.Links {
+		if link.Rel == "next" {
+			next = link.Href
+		}
+	}
+	if next != "http://example.com/hitomi/opds/search?page=1&q=female%3Aglasses" {
+		t.Errorf("next = %q", next)
+	}
+
+	_, body = read(t, server.URL+"/opds/v2/search?page=1")
+	var feed2 opds2Feed
+	if err := json.Unmarshal(body, &feed2); err != nil {
+		t.Fatal(err)
+	}
+	if feed2.Metadata.NumberOfItems != 3 || feed2.Metadata.CurrentPage != 2 || len(feed2.Publications) != 1 ||
+		feed2.Publications[0].Metadata.Identifier != "urn:hitomi:1" {
+		t.Errorf("feed = %+v", feed2)
+	}
+
+	resp, body = read(t, server.URL+"/opds/cbz/2")
+	if resp.Header.Get("Content-Type") != cbzType || string(body) != "archive 2" {
+		t.Errorf("/opds/cbz/2 = %q, %q", resp.Header.Get("Content-Type"), body)
+	}
+	if resp, _ := read(t, server.URL+"/opds/popular/week"); resp.StatusCode != 404 {
+		t.Errorf("/opds/popular/week = %d", resp.StatusCode)
+	}
+}
+
+func TestOPDS_CBZ(t *testing.T) {
+	server, _ := newTestServer(t, DefaultOptions())
+	resp, body := read(t, server.URL+"/opds/cbz/123")
+	if resp.StatusCode != 200 {
+		t.Fatalf("/opds/cbz/123 = %d, %s", resp.StatusCode, body)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "ComicInfo.xml" {
+		t.Errorf("files = %v", archive.File)
+	}
+}
+
+func TestOPDS_CBZ_ScriptUnlocked(t *testing.T) {
+	// gg.js is updated on every url, which must not wait for archives being streamed
+	server, h := newTestServer(t, DefaultOptions().WithScriptInterval(0))
+	h.SetGallery(124, `{"id": "124", "title": "test", "type": "manga", "files": [{"name": "1.webp", "hash": "`+testHash+`"}]}`)
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	h.Handle(func(req *http.Request) *http.Response {
+		if req.Header.Get("Referer") == "https://hitomi.la/reader/124.html" {
+			once.Do(func() { close(started) })
+			<-release
+		}
+		return nil
+	})
+
+	done := make(chan []byte)
+	go func() {
+		var body []byte
+		if resp, err := http.Get(server.URL + "/opds/cbz/124"); err == nil {
+			body, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+		}
+		done <- body
+	}()
+	<-started
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL + "/file/" + testHash)
+	close(release)
+	if err != nil {
+		t.Fatalf("/file while streaming cbz: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("/file while streaming cbz = %d", resp.StatusCode)
+	}
+	body := <-done
+	if archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body))); err != nil || len(archive.File) != 2 {
+		t.Errorf("cbz = %v, %v", archive, err)
+	}
+}
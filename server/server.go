@@ -0,0 +1,502 @@
+// Package server serves hitomi galleries, searches and images over an HTTP JSON API.
+//
+// Endpoints:
+//
+//	GET /gallery/{id}                    gallery information
+//	GET /search?q=&page=&size=           ids of galleries matching query, see hitomi.ParseQuery
+//	GET /search?cursor=&size=            next page of previous search
+//	GET /suggest?q=                      tag suggestions for [namespace:]prefix
+//	GET /popular/{period}?page=&size=    ids of popular galleries, period is one of hitomi.PopularPeriods
+//	GET /file/{hash}?gallery=            image of gallery file, fetched with the Referer hitomi requires
+//	                                     and stored in Options.Cache if it is set
+//	GET /thumbnail/{hash}?gallery=       small thumbnail of gallery file, fetched with the Referer hitomi requires
+//
+// Errors are responded as {"error": "..."}.
+// The handler also serves OPDS catalog feeds under /opds, see opds.go for the endpoints.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/library"
+)
+
+// Options are options for Handler.
+type Options struct {
+	// ScriptInterval is how often gg.js is refetched to calculate file urls.
+	ScriptInterval time.Duration
+
+	// DefaultPageSize is the number of ids per page when size is not given.
+	DefaultPageSize int
+
+	// MaxPageSize is the maximum number of ids per page.
+	MaxPageSize int
+
+	// Cache stores files served by /file/{hash}, if it is set.
+	Cache *FileCache
+
+	// Library is listed by OPDS feeds instead of live search results, if it is set.
+	Library *library.Library
+
+	// Filter excludes galleries from responses, if it is set.
+	// Excluded galleries are responded with 403 by /gallery/{id} and left out of feeds.
+	// Search results are narrowed down by Filter.Query, and ids of each page are checked with their metadata,
+	// so pages of /search and /popular may have fewer ids than size while Filter is set.
+	Filter *hitomi.Filter
+
+	// BaseURL is prepended to links in OPDS feeds, like "https://example.com/hitomi".
+	// It is needed when the handler is not mounted at the root of the host.
+	BaseURL string
+}
+
+func (o *Options) WithScriptInterval(d time.Duration) *Options {
+	o.ScriptInterval = d
+	return o
+}
+
+func (o *Options) WithDefaultPageSize(n int) *Options {
+	o.DefaultPageSize = n
+	return o
+}
+
+func (o *Options) WithMaxPageSize(n int) *Options {
+	o.MaxPageSize = n
+	return o
+}
+
+func (o *Options) WithCache(c *FileCache) *Options {
+	o.Cache = c
+	return o
+}
+
+func (o *Options) WithLibrary(l *library.Library) *Options {
+	o.Library = l
+	return o
+}
+
+func (o *Options) WithFilter(f *hitomi.Filter) *Options {
+	o.Filter = f
+	return o
+}
+
+func (o *Options) WithBaseURL(u string) *Options {
+	o.BaseURL = strings.TrimSuffix(u, "/")
+	return o
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		ScriptInterval:  10 * time.Minute,
+		DefaultPageSize: 25,
+		MaxPageSize:     1000,
+		Cache:           nil,
+		Library:         nil,
+		Filter:          nil,
+		BaseURL:         "",
+	}
+}
+
+// Handler is an http.Handler serving the API.
+type Handler struct {
+	options *hitomi.Options
+	opts    *Options
+	client  *hitomi.Client
+	search  *hitomi.Search
+	mux     *http.ServeMux
+}
+
+// New returns a handler using client and search made of options.
+// options.Client is also used to fetch proxied files.
+// options.UpdateScriptInterval is replaced by Options.ScriptInterval for the client of the handler.
+func New(options *hitomi.Options, opts *Options) *Handler {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	clientOptions := *options
+	clientOptions.UpdateScriptInterval = opts.ScriptInterval
+	h := &Handler{
+		options: options,
+		opts:    opts,
+		client:  hitomi.NewClient(&clientOptions),
+		search:  hitomi.NewSearch(options),
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /gallery/{id}", h.gallery)
+	h.mux.HandleFunc("GET /search", h.query)
+	h.mux.HandleFunc("GET /suggest", h.suggest)
+	h.mux.HandleFunc("GET /popular/{period}", h.popular)
+	h.mux.HandleFunc("GET /file/{hash}", h.file)
+	h.mux.HandleFunc("GET /thumbnail/{hash}", h.thumbnail)
+	h.handleOPDS()
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// writeJSON responds v as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// page returns offset and size of page requested by query parameters.
+func (h *Handler) page(r *http.Request) (int, int, error) {
+	page, size := 0, h.opts.DefaultPageSize
+	if v := r.FormValue("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("invalid page: " + v)
+		}
+		page = n
+	}
+	if v := r.FormValue("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, errors.New("invalid size: " + v)
+		}
+		size = n
+	}
+	size = min(size, h.opts.MaxPageSize)
+	return page * size, size, nil
+}
+
+func (h *Handler) gallery(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid id: "+id))
+		return
+	}
+	g, err := h.client.GalleryContext(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if err := h.check(g); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// check returns the exclusion of g by Options.Filter, or nil if there is no filter or g is allowed.
+func (h *Handler) check(g *hitomi.Gallery) error {
+	if h.opts.Filter == nil {
+		return nil
+	}
+	if exclusion := h.opts.Filter.Check(g); exclusion != nil {
+		return exclusion
+	}
+	return nil
+}
+
+// searchResponse is the response of /search.
+type searchResponse struct {
+	Query  string `json:"query"`
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+	IDs    []int  `json:"ids"`
+	// Next is the cursor of the next page, empty at the last page.
+	Next string `json:"next,omitempty"`
+}
+
+func (h *Handler) query(w http.ResponseWriter, r *http.Request) {
+	offset, size, err := h.page(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var result *hitomi.SearchResult
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		result, offset, err = h.search.Resume(cursor)
+		if errors.Is(err, hitomi.ErrIndexChanged) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	} else {
+		result, err = h.search.Query(h.opts.Filter.Query(r.FormValue("q")))
+	}
+	var queryErr *hitomi.QueryError
+	if errors.As(err, &queryErr) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	resp := searchResponse{
+		Query:  result.Query,
+		Total:  result.Total(),
+		Offset: offset,
+		IDs:    h.allowedIDs(r.Context(), result.Range(offset, size)),
+	}
+	if resp.IDs == nil {
+		resp.IDs = []int{}
+	}
+	if offset+size < result.Total() {
+		resp.Next = result.Cursor(offset + size)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// suggestion is an item of the response of /suggest.
+type suggestion struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func (h *Handler) suggest(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("q")
+	var suggestions []hitomi.Suggestion
+	var err error
+	if strings.Contains(q, ":") {
+		if _, parseErr := hitomi.ParseTag(q); parseErr != nil {
+			writeError(w, http.StatusBadRequest, parseErr)
+			return
+		}
+		suggestions, err = h.search.TagSuggestion(q)
+	} else {
+		suggestions, err = h.search.Suggest(q)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	resp := make([]suggestion, len(suggestions))
+	for i, s := range suggestions {
+		resp[i] = suggestion{Tag: s.String(), Count: s.Count}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// popularResponse is the response of /popular/{period}.
+type popularResponse struct {
+	Period string `json:"period"`
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+	IDs    []int  `json:"ids"`
+}
+
+func (h *Handler) popular(w http.ResponseWriter, r *http.Request) {
+	tag, err := hitomi.PopularTag(r.PathValue("period"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	offset, size, err := h.page(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ids, total, err := h.popularIDs(r.Context(), tag, offset, size)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, popularResponse{
+		Period: tag.Name,
+		Total:  total,
+		Offset: offset,
+		IDs:    h.allowedIDs(r.Context(), ids),
+	})
+}
+
+// allowedIDs returns ids of galleries allowed by Options.Filter in order, fetching their metadata to check them.
+// Galleries which failed to fetch are left out, since they cannot be checked. ids are returned as is without Filter.
+func (h *Handler) allowedIDs(ctx context.Context, ids []int) []int {
+	if h.opts.Filter == nil {
+		return ids
+	}
+	allowed := []int{}
+	for _, g := range h.galleries(ctx, ids) {
+		if id, err := strconv.Atoi(g.Id); err == nil {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed
+}
+
+// popularIDs returns size ids of popular galleries from offset and total number of them,
+// requesting only the page instead of the whole nozomi file.
+func (h *Handler) popularIDs(ctx context.Context, tag hitomi.Tag, offset, size int) ([]int, int, error) {
+	ids, total, err := h.search.GalleryIDsRange(ctx, tag, offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	if total < 0 {
+		// not reported, so count up to this page
+		total = offset + len(ids)
+	}
+	return ids, total, nil
+}
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// proxiedHeaders are headers of file response passed to clients.
+var proxiedHeaders = []string{"Content-Type", "Content-Length", "Last-Modified"}
+
+// upstreamError is returned when hitomi responded with an error status.
+type upstreamError struct {
+	StatusCode int
+}
+
+func (e *upstreamError) Error() string {
+	return "failed to get file: " + strconv.Itoa(e.StatusCode)
+}
+
+// fileParams returns hash and gallery id requested by r, responding an error if they are invalid.
+// It also sets caching headers, responding 304 if the client has the file already.
+func fileParams(w http.ResponseWriter, r *http.Request) (hash, galleryId string, ok bool) {
+	hash = strings.ToLower(r.PathValue("hash"))
+	if !hashPattern.MatchString(hash) {
+		writeError(w, http.StatusBadRequest, errors.New("invalid hash: "+hash))
+		return "", "", false
+	}
+	galleryId = r.FormValue("gallery")
+	if _, err := strconv.Atoi(galleryId); galleryId != "" && err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid gallery: "+galleryId))
+		return "", "", false
+	}
+
+	// files never change since they are addressed by hash,
+	// but "*" is not honored since the file of hash may not exist
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.Header.Get("If-None-Match") == `"`+hash+`"` {
+		w.WriteHeader(http.StatusNotModified)
+		return "", "", false
+	}
+	return hash, galleryId, true
+}
+
+func (h *Handler) file(w http.ResponseWriter, r *http.Request) {
+	hash, galleryId, ok := fileParams(w, r)
+	if !ok {
+		return
+	}
+
+	if h.opts.Cache != nil {
+		// keep fetching for other waiting requests even if this request is canceled
+		ctx := context.WithoutCancel(r.Context())
+		f, err := h.opts.Cache.Fetch(hash, func(w io.Writer) error {
+			resp, err := h.fetchFile(ctx, hash, galleryId)
+			if err != nil {
+				return err
+			}
+			defer func(Body io.ReadCloser) {
+				_ = Body.Close()
+			}(resp.Body)
+			_, err = io.Copy(w, resp.Body)
+			return err
+		})
+		if err != nil {
+			writeFileError(w, err)
+			return
+		}
+		defer func(f *os.File) {
+			_ = f.Close()
+		}(f)
+		w.Header().Set("Content-Type", "image/webp")
+		http.ServeContent(w, r, "", time.Time{}, f)
+		return
+	}
+
+	resp, err := h.fetchFile(r.Context(), hash, galleryId)
+	proxy(w, resp, err)
+}
+
+func (h *Handler) thumbnail(w http.ResponseWriter, r *http.Request) {
+	hash, galleryId, ok := fileParams(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.fetch(r.Context(), thumbnailURL(hash), galleryId)
+	proxy(w, resp, err)
+}
+
+// proxy responds resp of fetching a file, or err if it failed.
+func proxy(w http.ResponseWriter, resp *http.Response, err error) {
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	for _, name := range proxiedHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// thumbnailURL returns url of the small thumbnail hitomi shows in galleries listings for file of hash.
+func thumbnailURL(hash string) string {
+	return fmt.Sprintf("https://tn.hitomi.la/webpsmalltn/%s/%s/%s.webp", hash[len(hash)-1:], hash[len(hash)-3:len(hash)-1], hash)
+}
+
+// fetchFile requests file of hash from hitomi with the Referer of gallery.
+func (h *Handler) fetchFile(ctx context.Context, hash, galleryId string) (*http.Response, error) {
+	url, err := h.fileURL(hash)
+	if err != nil {
+		return nil, err
+	}
+	return h.fetch(ctx, url, galleryId)
+}
+
+// fetch requests url from hitomi with the Referer of gallery.
+func (h *Handler) fetch(ctx context.Context, url, galleryId string) (*http.Response, error) {
+	resp, err := h.options.Client.Do(h.client.FileRequest(url, galleryId).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		_ = resp.Body.Close()
+		return nil, &upstreamError{StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+func writeFileError(w http.ResponseWriter, err error) {
+	// clear headers of successful response
+	w.Header().Del("ETag")
+	w.Header().Del("Cache-Control")
+	var upstreamErr *upstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusBadGateway, err)
+}
+
+// fileURL returns url of file, updating gg.js if it is older than ScriptInterval.
+func (h *Handler) fileURL(hash string) (string, error) {
+	url := h.client.FileURL(hash)
+	if url == "" {
+		return "", errors.New("failed to get gg.js")
+	}
+	return url, nil
+}
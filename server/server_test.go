@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+const testHash = "5d8a4f1bc3b2e6f7a9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2"
+
+// newTestServer returns a server whose upstream is stubbed, and the upstream.
+func newTestServer(t *testing.T, opts *Options) (*httptest.Server, *stub.Hitomi) {
+	h := stub.New()
+	h.SetGallery(123, `{"id": "123", "title": "test", "type": "manga"}`)
+	h.SetNozomi("popular/week-all.nozomi", 5, 4, 3, 2, 1)
+	h.SetNozomi("index-korean.nozomi", 9, 8, 7)
+	h.SetFile(testHash, "image")
+	server := httptest.NewServer(New(hitomi.DefaultOptions().WithClient(h.Client()), opts.WithDefaultPageSize(2)))
+	t.Cleanup(server.Close)
+	return server, h
+}
+
+func get(t *testing.T, url string, v any) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHandler(t *testing.T) {
+	server, h := newTestServer(t, DefaultOptions())
+
+	var g hitomi.Gallery
+	if status := get(t, server.URL+"/gallery/123", &g); status != 200 || g.Title != "test" || g.Type != hitomi.GalleryTypeManga {
+		t.Errorf("/gallery/123 = %d, %+v", status, g)
+	}
+	if status := get(t, server.URL+"/gallery/abc", nil); status != 400 {
+		t.Errorf("/gallery/abc = %d", status)
+	}
+
+	var search searchResponse
+	if status := get(t, server.URL+"/search?q=language:korean", &search); status != 200 ||
+		search.Total != 3 || len(search.IDs) != 2 || search.Next == "" {
+		t.Errorf("/search = %d, %+v", status, search)
+	}
+	next := search.Next
+	search = searchResponse{}
+	if status := get(t, server.URL+"/search?cursor="+next, &search); status != 200 ||
+		search.Offset != 2 || len(search.IDs) != 1 || search.IDs[0] != 7 || search.Next != "" {
+		t.Errorf("/search?cursor = %d, %+v", status, search)
+	}
+	if status := get(t, server.URL+"/search?q=(language:korean", nil); status != 400 {
+		t.Errorf("/search invalid query = %d", status)
+	}
+
+	var popular popularResponse
+	if status := get(t, server.URL+"/popular/week?page=1", &popular); status != 200 ||
+		popular.Total != 5 || len(popular.IDs) != 2 || popular.IDs[0] != 3 {
+		t.Errorf("/popular/week = %d, %+v", status, popular)
+	}
+	// only the page is requested, not the whole nozomi file
+	requests := h.Requests()
+	if got := requests[len(requests)-1].Header.Get("Range"); got != "bytes=8-15" {
+		t.Errorf("/popular/week Range = %q", got)
+	}
+	if status := get(t, server.URL+"/popular/decade", nil); status != 404 {
+		t.Errorf("/popular/decade = %d", status)
+	}
+}
+
+func TestHandler_File(t *testing.T) {
+	server, h := newTestServer(t, DefaultOptions())
+
+	resp, err := http.Get(server.URL + "/file/" + testHash + "?gallery=123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "image" || resp.Header.Get("Content-Type") != "image/webp" {
+		t.Errorf("/file = %d, %q, %q", resp.StatusCode, body, resp.Header.Get("Content-Type"))
+	}
+	upstream := h.Requests()[len(h.Requests())-1]
+	if referer := upstream.Header.Get("Referer"); referer != "https://hitomi.la/reader/123.html" {
+		t.Errorf("Referer = %q", referer)
+	}
+
+	if status := get(t, server.URL+"/file/xyz", nil); status != 400 {
+		t.Errorf("/file/xyz = %d", status)
+	}
+	if status := get(t, server.URL+"/file/"+strings.Repeat("0", 64), nil); status != 404 {
+		t.Errorf("/file/unknown = %d", status)
+	}
+	// "*" must not claim that files never served exist
+	req, _ := http.NewRequest("GET", server.URL+"/file/"+strings.Repeat("0", 64), nil)
+	req.Header.Set("If-None-Match", "*")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != 404 {
+		t.Errorf("/file/unknown with If-None-Match: * = %v, %v", resp, err)
+	} else {
+		_ = resp.Body.Close()
+	}
+
+	resp, err = http.Get(server.URL + "/thumbnail/" + testHash + "?gallery=123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	upstream = h.Requests()[len(h.Requests())-1]
+	if resp.StatusCode != 200 || upstream.URL.String() != "https://tn.hitomi.la/webpsmalltn/2/1a/"+testHash+".webp" {
+		t.Errorf("/thumbnail = %d from %s", resp.StatusCode, upstream.URL)
+	}
+	// gg.js is fetched once and reused for later files
+	var scripts int
+	for _, req := range h.Requests() {
+		if path.Base(req.URL.Path) == "gg.js" {
+			scripts++
+		}
+	}
+	if scripts != 1 {
+		t.Errorf("gg.js fetched %d times", scripts)
+	}
+}
+
+func TestHandler_Filter(t *testing.T) {
+	filter := &hitomi.Filter{BlockedTypes: []hitomi.GalleryType{hitomi.GalleryTypeManga}}
+	server, _ := newTestServer(t, DefaultOptions().WithFilter(filter))
+
+	var resp struct{ Error string }
+	if status := get(t, server.URL+"/gallery/123", &resp); status != 403 || !strings.Contains(resp.Error, "BlockedTypes") {
+		t.Errorf("/gallery/123 = %d, %+v", status, resp)
+	}
+}
+
+func TestHandler_Filter_IDs(t *testing.T) {
+	filter := &hitomi.Filter{BlockedTypes: []hitomi.GalleryType{hitomi.GalleryTypeManga}}
+	server, h := newTestServer(t, DefaultOptions().WithFilter(filter))
+	// type:manga is missing 8, so only checking metadata excludes it, and 9 and 5 are blocked by hitomi
+	h.SetNozomi("type/manga-all.nozomi")
+	h.SetGallery(9, `{"id": "9", "type": "doujinshi", "blocked": 1}`)
+	h.SetGallery(8, `{"id": "8", "type": "manga"}`)
+	h.SetGallery(7, `{"id": "7", "type": "doujinshi"}`)
+	h.SetGallery(5, `{"id": "5", "type": "doujinshi", "blocked": 1}`)
+	h.SetGallery(4, `{"id": "4", "type": "doujinshi"}`)
+
+	var search searchResponse
+	if status := get(t, server.URL+"/search?q=language:korean&size=3", &search); status != 200 ||
+		len(search.IDs) != 1 || search.IDs[0] != 7 {
+		t.Errorf("/search = %d, %+v", status, search)
+	}
+	var popular popularResponse
+	if status := get(t, server.URL+"/popular/week", &popular); status != 200 ||
+		len(popular.IDs) != 1 || popular.IDs[0] != 4 {
+		t.Errorf("/popular/week = %d, %+v", status, popular)
+	}
+}
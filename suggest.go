@@ -0,0 +1,65 @@
+package hitomi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SuggestNamespaces are namespaces searched by Search.Suggest.
+var SuggestNamespaces = []string{
+	NamespaceTag,
+	NamespaceFemale,
+	NamespaceMale,
+	NamespaceArtist,
+	NamespaceSeries,
+	NamespaceCharacter,
+	NamespaceGroup,
+	NamespaceLanguage,
+}
+
+// Suggest returns tag suggestions for prefix from every namespace of SuggestNamespaces.
+// Namespaces are searched in parallel, and the suggestions are merged
+// and sorted by the number of galleries with the tag, most first.
+func (s *Search) Suggest(prefix string) ([]Suggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	if strings.Contains(prefix, ":") {
+		return nil, fmt.Errorf("invalid prefix: %s", prefix)
+	}
+
+	results := make([][]Suggestion, len(SuggestNamespaces))
+	errs := make([]error, len(SuggestNamespaces))
+	var wg sync.WaitGroup
+	for i, namespace := range SuggestNamespaces {
+		tag, err := ParseTag(namespace + ":" + prefix)
+		if err != nil {
+			return nil, err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.suggestions(tag)
+			if errors.Is(errs[i], errKeyNotFound) {
+				errs[i] = nil
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var merged []Suggestion
+	seen := map[Tag]bool{}
+	for _, result := range results {
+		for _, item := range result {
+			if !seen[item.Tag] {
+				seen[item.Tag] = true
+				merged = append(merged, item)
+			}
+		}
+	}
+	sortSuggestions(merged)
+	return merged, nil
+}
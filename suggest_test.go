@@ -0,0 +1,114 @@
+package hitomi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/EINNN7/hitomi/internal/stub"
+	"github.com/EINNN7/hitomi/internal/util"
+)
+
+// encodeNode encodes a binary tree node in the format of hitomi index.
+func encodeNode(keys [][]byte, data [][2]int, subNodes []int) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, uint32(len(keys)))
+	for _, key := range keys {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(key)))
+		b = append(b, key...)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	for _, d := range data {
+		b = binary.BigEndian.AppendUint64(b, uint64(d[0]))
+		b = binary.BigEndian.AppendUint32(b, uint32(d[1]))
+	}
+	for i := 0; i < 17; i++ {
+		var address int
+		if i < len(subNodes) {
+			address = subNodes[i]
+		}
+		b = binary.BigEndian.AppendUint64(b, uint64(address))
+	}
+	return b
+}
+
+// encodeSuggestions encodes suggestions in the format of tagindex data.
+func encodeSuggestions(suggestions []Suggestion) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, uint32(len(suggestions)))
+	for _, s := range suggestions {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s.Tag.Namespace)))
+		b = append(b, s.Tag.Namespace...)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s.Tag.Name)))
+		b = append(b, s.Tag.Name...)
+		b = binary.BigEndian.AppendUint32(b, uint32(s.Count))
+	}
+	return b
+}
+
+// tagIndexServer serves tagindex with a single root node per field,
+// which has suggestions of one prefix.
+func tagIndexServer(prefix string, suggestions map[string][]Suggestion) *http.Client {
+	var mu sync.Mutex
+	return stub.Client(func(req *http.Request) *http.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path == "/tagindex/version" {
+			return stub.Response(200, "1")
+		}
+		name := strings.TrimPrefix(req.URL.Path, "/tagindex/")
+		field, ext, _ := strings.Cut(name, ".1.")
+		items, ok := suggestions[field]
+		if !ok {
+			return stub.Response(404, "")
+		}
+		data := encodeSuggestions(items)
+		switch ext {
+		case "index":
+			return stub.Response(200, string(encodeNode([][]byte{util.HashTerm(prefix)}, [][2]int{{0, len(data)}}, nil)))
+		case "data":
+			return stub.Response(200, string(data))
+		}
+		return stub.Response(404, "")
+	})
+}
+
+func TestSearch_Suggest(t *testing.T) {
+	s := NewSearch(DefaultOptions().WithClient(tagIndexServer("big", map[string][]Suggestion{
+		"tag":       {{Tag{"tag", "big ass"}, 300}},
+		"female":    {{Tag{"female", "big breasts"}, 1000}, {Tag{"female", "big ass"}, 500}},
+		"male":      {{Tag{"male", "big penis"}, 700}},
+		"artist":    {{Tag{"artist", "bigboss"}, 10}},
+		"series":    {},
+		"character": {},
+		"group":     {{Tag{"group", "big hand"}, 20}},
+		"language":  {},
+	})))
+	tags, err := s.Suggest("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[female:big_breasts male:big_penis female:big_ass tag:big_ass group:big_hand artist:bigboss]"
+	if got := fmt.Sprint(tags); got != want {
+		t.Errorf("Suggest = %s, want %s", got, want)
+	}
+
+	tags, err = s.Suggest("small")
+	if err != nil || len(tags) != 0 {
+		t.Errorf("Suggest(missing) = %v, %v", tags, err)
+	}
+
+	tags, err = s.TagSuggestion("female:big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tags); got != "[female:big_breasts female:big_ass]" {
+		t.Errorf("TagSuggestion = %s", got)
+	}
+	if tags[0].Namespace != "female" || tags[0].Name != "big breasts" || tags[0].Count != 1000 {
+		t.Errorf("TagSuggestion()[0] = %#v", tags[0])
+	}
+}
@@ -0,0 +1,136 @@
+package hitomi
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/EINNN7/hitomi/internal/util"
+)
+
+// Namespaces known by hitomi.
+const (
+	NamespaceTag       = "tag"
+	NamespaceFemale    = "female"
+	NamespaceMale      = "male"
+	NamespaceArtist    = "artist"
+	NamespaceGroup     = "group"
+	NamespaceSeries    = "series"
+	NamespaceCharacter = "character"
+	NamespaceType      = "type"
+	NamespaceLanguage  = "language"
+)
+
+// PopularPeriods are periods of popular galleries listed by hitomi.
+var PopularPeriods = []string{"today", "week", "month", "year"}
+
+// PopularTag returns the tag whose nozomi file lists popular galleries of period, most popular first.
+// The tag is only usable with Search.GalleryIDs and GalleryIDsSeq, not in queries.
+func PopularTag(period string) (Tag, error) {
+	period = strings.ToLower(strings.TrimSpace(period))
+	if !slices.Contains(PopularPeriods, period) {
+		return Tag{}, fmt.Errorf("invalid popular period: %s", period)
+	}
+	return Tag{Namespace: "popular", Name: period}, nil
+}
+
+// Tag is a namespaced tag such as "female:big_breasts".
+// Name is stored as hitomi stores it, with spaces instead of underscores.
+type Tag struct {
+	Namespace string
+	Name      string
+}
+
+// ParseTag parses a tag in the form of "namespace:name".
+// Underscores in name are treated as spaces.
+// Name may be empty, which is useful when the tag is used as a suggestion prefix.
+func ParseTag(s string) (Tag, error) {
+	namespace, name, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Tag{}, fmt.Errorf("invalid tag: %s", s)
+	}
+	namespace = strings.ToLower(strings.TrimSpace(namespace))
+	if namespace == "" || strings.ContainsAny(namespace, " _") {
+		return Tag{}, fmt.Errorf("invalid tag namespace: %s", s)
+	}
+	return Tag{
+		Namespace: namespace,
+		Name:      strings.ToLower(strings.TrimSpace(strings.ReplaceAll(name, "_", " "))),
+	}, nil
+}
+
+// String returns the tag in the form of "namespace:name" with spaces replaced by underscores.
+func (t Tag) String() string {
+	return t.Namespace + ":" + strings.ReplaceAll(t.Name, " ", "_")
+}
+
+// NozomiPath returns the path of the nozomi file listing galleries with the tag,
+// relative to https://ltn.hitomi.la/n/.
+func (t Tag) NozomiPath() string {
+	switch t.Namespace {
+	case NamespaceLanguage:
+		return fmt.Sprintf("index-%s.nozomi", t.Name)
+	case NamespaceFemale, NamespaceMale:
+		return fmt.Sprintf("tag/%s:%s-all.nozomi", t.Namespace, t.Name)
+	default:
+		return fmt.Sprintf("%s/%s-all.nozomi", t.Namespace, t.Name)
+	}
+}
+
+// URL returns the url of the tag page on hitomi.la.
+func (t Tag) URL() string {
+	switch t.Namespace {
+	case NamespaceLanguage:
+		return fmt.Sprintf("https://hitomi.la/index-%s.html", escapeComponent(t.Name))
+	case NamespaceFemale, NamespaceMale:
+		return fmt.Sprintf("https://hitomi.la/tag/%s-all.html", escapeComponent(t.Namespace+":"+t.Name))
+	default:
+		return fmt.Sprintf("https://hitomi.la/%s/%s-all.html", t.Namespace, escapeComponent(t.Name))
+	}
+}
+
+// SuggestionKey returns the tagindex field and B-tree key used to look up suggestions for the tag.
+func (t Tag) SuggestionKey() (string, []byte) {
+	return t.Namespace, util.HashTerm(t.Name)
+}
+
+// escapeComponent escapes s like javascript's encodeURIComponent, which hitomi uses for its urls.
+func escapeComponent(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// parseTagURL parses url of tag page on hitomi.la, which is the inverse of Tag.URL.
+// Both absolute and site-relative urls are accepted.
+func parseTagURL(s string) (Tag, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https:"), "//hitomi.la")
+	if name, ok := strings.CutPrefix(s, "/index-"); ok {
+		name, ok = strings.CutSuffix(name, ".html")
+		if !ok {
+			return Tag{}, false
+		}
+		name, err := url.PathUnescape(name)
+		if err != nil {
+			return Tag{}, false
+		}
+		return Tag{Namespace: NamespaceLanguage, Name: name}, true
+	}
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(s, "/"), "/")
+	if !ok {
+		return Tag{}, false
+	}
+	name, ok = strings.CutSuffix(name, "-all.html")
+	if !ok {
+		return Tag{}, false
+	}
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		return Tag{}, false
+	}
+	if namespace == NamespaceTag {
+		if tag, err := ParseTag(name); err == nil && (tag.Namespace == NamespaceFemale || tag.Namespace == NamespaceMale) {
+			return Tag{Namespace: tag.Namespace, Name: strings.TrimPrefix(name, tag.Namespace+":")}, true
+		}
+	}
+	return Tag{Namespace: namespace, Name: name}, true
+}
@@ -0,0 +1,98 @@
+package hitomi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/EINNN7/hitomi/internal/util"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Tag
+	}{
+		{"female:big_breasts", Tag{Namespace: "female", Name: "big breasts"}},
+		{"Female:Big Breasts", Tag{Namespace: "female", Name: "big breasts"}},
+		{"tag:", Tag{Namespace: "tag", Name: ""}},
+		{"artist:foo:bar", Tag{Namespace: "artist", Name: "foo:bar"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTag(tt.in)
+		if err != nil {
+			t.Fatalf("ParseTag(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseTag(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"big_breasts", ":big", "fe male:big"} {
+		if _, err := ParseTag(in); err == nil {
+			t.Errorf("ParseTag(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestTag_Mapping(t *testing.T) {
+	tests := []struct {
+		tag    Tag
+		str    string
+		nozomi string
+		url    string
+	}{
+		{
+			Tag{Namespace: "female", Name: "big breasts"},
+			"female:big_breasts",
+			"tag/female:big breasts-all.nozomi",
+			"https://hitomi.la/tag/female%3Abig%20breasts-all.html",
+		},
+		{
+			Tag{Namespace: "tag", Name: "full color"},
+			"tag:full_color",
+			"tag/full color-all.nozomi",
+			"https://hitomi.la/tag/full%20color-all.html",
+		},
+		{
+			Tag{Namespace: "language", Name: "korean"},
+			"language:korean",
+			"index-korean.nozomi",
+			"https://hitomi.la/index-korean.html",
+		},
+		{
+			Tag{Namespace: "artist", Name: "some artist"},
+			"artist:some_artist",
+			"artist/some artist-all.nozomi",
+			"https://hitomi.la/artist/some%20artist-all.html",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.tag.String(); got != tt.str {
+			t.Errorf("String() = %q, want %q", got, tt.str)
+		}
+		if got := tt.tag.NozomiPath(); got != tt.nozomi {
+			t.Errorf("NozomiPath() = %q, want %q", got, tt.nozomi)
+		}
+		if got := tt.tag.URL(); got != tt.url {
+			t.Errorf("URL() = %q, want %q", got, tt.url)
+		}
+		parsed, err := ParseTag(tt.str)
+		if err != nil || parsed != tt.tag {
+			t.Errorf("ParseTag(%q) = %#v, %v; want %#v", tt.str, parsed, err, tt.tag)
+		}
+	}
+
+	field, key := Tag{Namespace: "female", Name: "big breasts"}.SuggestionKey()
+	if field != "female" || !bytes.Equal(key, util.HashTerm("big breasts")) {
+		t.Errorf("SuggestionKey() = %q, %x", field, key)
+	}
+}
+
+func TestPopularTag(t *testing.T) {
+	tag, err := PopularTag("Week")
+	if err != nil || tag.NozomiPath() != "popular/week-all.nozomi" {
+		t.Errorf("PopularTag(Week) = %v, %v", tag.NozomiPath(), err)
+	}
+	if _, err := PopularTag("decade"); err == nil {
+		t.Error("PopularTag(decade) did not fail")
+	}
+}
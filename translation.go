@@ -0,0 +1,140 @@
+package hitomi
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TranslationIDs returns ids of every gallery in the translation group of g, including g itself, in ascending order.
+// It does not make any request since g.Languages lists the whole group.
+func (g *Gallery) TranslationIDs() []int {
+	var ids []int
+	if id, err := strconv.Atoi(g.Id); err == nil {
+		ids = append(ids, id)
+	}
+	for _, language := range g.Languages {
+		if id, err := strconv.Atoi(language.GalleryId); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// TranslationGroupKey returns an id shared by every gallery in the translation group of g,
+// which is the smallest id of the group.
+func (g *Gallery) TranslationGroupKey() int {
+	ids := g.TranslationIDs()
+	if len(ids) == 0 {
+		return 0
+	}
+	return ids[0]
+}
+
+// BestTranslation returns id of gallery in the translation group of g whose language comes first in languages,
+// like []string{"korean", "english", "japanese"}.
+// It returns id of g itself if no language of the group is in languages.
+func (g *Gallery) BestTranslation(languages []string) string {
+	best, rank := g.Id, languageRank(g.Language, languages)
+	for _, language := range g.Languages {
+		if r := languageRank(language.Name, languages); r < rank {
+			best, rank = language.GalleryId, r
+		}
+	}
+	return best
+}
+
+// languageRank returns index of language in languages, or len(languages) if it is not in languages.
+func languageRank(language string, languages []string) int {
+	i := slices.IndexFunc(languages, func(l string) bool { return strings.EqualFold(l, language) })
+	if i < 0 {
+		return len(languages)
+	}
+	return i
+}
+
+// TranslationGroup fetches every gallery in the translation group of g, including g itself, in ascending order of id.
+// Galleries which failed to fetch are left out and reported in the returned error.
+func (c *Client) TranslationGroup(ctx context.Context, g *Gallery, opts *BatchOptions) ([]*Gallery, error) {
+	var ids []int
+	for _, id := range g.TranslationIDs() {
+		if strconv.Itoa(id) != g.Id {
+			ids = append(ids, id)
+		}
+	}
+	group := []*Gallery{g}
+	var errs []error
+	for result := range c.Galleries(ctx, ids, opts) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			continue
+		}
+		group = append(group, result.Gallery)
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	slices.SortFunc(group, func(a, b *Gallery) int {
+		x, _ := strconv.Atoi(a.Id)
+		y, _ := strconv.Atoi(b.Id)
+		return x - y
+	})
+	return group, errors.Join(errs...)
+}
+
+// DedupeTranslations returns galleries with only one gallery of each translation group,
+// the one whose language comes first in languages among galleries of the group in galleries.
+// Groups are kept in the order they first appear in galleries.
+func DedupeTranslations(galleries []*Gallery, languages []string) []*Gallery {
+	index := map[int]int{}
+	var result []*Gallery
+	for _, g := range galleries {
+		key := g.TranslationGroupKey()
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(result)
+			result = append(result, g)
+			continue
+		}
+		if languageRank(g.Language, languages) < languageRank(result[i].Language, languages) {
+			result[i] = g
+		}
+	}
+	return result
+}
+
+// PreferTranslations is like DedupeTranslations, but replaces each gallery with its best translation
+// by languages even if the translation is not in galleries, fetching it.
+// Galleries whose translation failed to fetch are kept as they are, and the errors are returned.
+func (c *Client) PreferTranslations(ctx context.Context, galleries []*Gallery, languages []string, opts *BatchOptions) ([]*Gallery, error) {
+	result := DedupeTranslations(galleries, languages)
+	var ids []int
+	replace := map[int]int{}
+	for i, g := range result {
+		best := g.BestTranslation(languages)
+		if best == g.Id {
+			continue
+		}
+		id, err := strconv.Atoi(best)
+		if err != nil {
+			continue
+		}
+		replace[id] = i
+		ids = append(ids, id)
+	}
+	var errs []error
+	for r := range c.Galleries(ctx, ids, opts) {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+			continue
+		}
+		result[replace[r.Id]] = r.Gallery
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return result, errors.Join(errs...)
+}
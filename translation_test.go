@@ -0,0 +1,67 @@
+package hitomi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// translationScripts are gallery scripts of a group translated into three languages and an unrelated gallery.
+var translationScripts = map[int]string{
+	10: `{"id": 10, "language": "japanese", "languages": [{"galleryid": "20", "name": "korean"}, {"galleryid": "30", "name": "english"}]}`,
+	20: `{"id": 20, "language": "korean", "languages": [{"galleryid": "10", "name": "japanese"}, {"galleryid": "30", "name": "english"}]}`,
+	30: `{"id": 30, "language": "english", "languages": [{"galleryid": "10", "name": "japanese"}, {"galleryid": "20", "name": "korean"}]}`,
+	40: `{"id": 40, "language": "japanese"}`,
+}
+
+func galleryIDs(galleries []*Gallery) string {
+	var ids []string
+	for _, g := range galleries {
+		ids = append(ids, g.Id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestGallery_Translations(t *testing.T) {
+	_, galleries := scriptClient(t, translationScripts)
+	if got := fmt.Sprint(galleries["30"].TranslationIDs()); got != "[10 20 30]" {
+		t.Errorf("TranslationIDs = %s", got)
+	}
+	if got := galleries["20"].TranslationGroupKey(); got != 10 {
+		t.Errorf("TranslationGroupKey = %d", got)
+	}
+	if got := galleries["10"].BestTranslation([]string{"Korean", "english"}); got != "20" {
+		t.Errorf("BestTranslation = %s", got)
+	}
+	if got := galleries["30"].BestTranslation([]string{"chinese"}); got != "30" {
+		t.Errorf("BestTranslation without match = %s", got)
+	}
+}
+
+func TestClient_TranslationGroup(t *testing.T) {
+	client, galleries := scriptClient(t, translationScripts)
+	group, err := client.TranslationGroup(context.Background(), galleries["20"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := galleryIDs(group); got != "10,20,30" {
+		t.Errorf("TranslationGroup = %s", got)
+	}
+}
+
+func TestDedupeTranslations(t *testing.T) {
+	client, galleries := scriptClient(t, translationScripts)
+	results := []*Gallery{galleries["10"], galleries["40"], galleries["30"]}
+	languages := []string{"korean", "english"}
+	if got := galleryIDs(DedupeTranslations(results, languages)); got != "30,40" {
+		t.Errorf("DedupeTranslations = %s", got)
+	}
+	preferred, err := client.PreferTranslations(context.Background(), results, languages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := galleryIDs(preferred); got != "20,40" {
+		t.Errorf("PreferTranslations = %s", got)
+	}
+}
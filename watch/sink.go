@@ -0,0 +1,335 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Sink delivers events somewhere outside of the program.
+// Implementations must be safe for concurrent use.
+type Sink interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// SinkFunc is a function used as Sink.
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Send(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Handler returns handler for Watcher.Run which sends events to sink,
+// calling onError with errors of sink if it is not nil.
+func Handler(ctx context.Context, sink Sink, onError func(err error)) func(Event) {
+	return func(event Event) {
+		if err := sink.Send(ctx, event); err != nil && onError != nil {
+			onError(fmt.Errorf("send %s: %w", event.Gallery.Id, err))
+		}
+	}
+}
+
+// Payload is the JSON form of event sent by sinks.
+type Payload struct {
+	Subscription string   `json:"subscription"`
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	URL          string   `json:"url"`
+	Type         string   `json:"type"`
+	Language     string   `json:"language,omitempty"`
+	Artists      []string `json:"artists,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	Series       []string `json:"series,omitempty"`
+	Characters   []string `json:"characters,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Pages        int      `json:"pages"`
+	// Published is in RFC 3339 format, empty if unknown.
+	Published string `json:"published,omitempty"`
+}
+
+// NewPayload returns payload of event.
+func NewPayload(event Event) Payload {
+	g := event.Gallery
+	p := Payload{
+		Subscription: event.Subscription.Name,
+		ID:           g.Id,
+		Title:        g.Title,
+		URL:          "https://hitomi.la" + g.GalleryUrl,
+		Type:         g.Type.String(),
+		Language:     g.Language,
+		Pages:        len(g.Files),
+	}
+	if !g.Published.IsZero() {
+		p.Published = g.Published.Format(time.RFC3339)
+	}
+	if g.GalleryUrl == "" {
+		p.URL = fmt.Sprintf("https://hitomi.la/galleries/%s.html", g.Id)
+	}
+	for _, a := range g.Artists {
+		p.Artists = append(p.Artists, a.Artist)
+	}
+	for _, group := range g.Groups {
+		p.Groups = append(p.Groups, group.Group)
+	}
+	for _, parody := range g.Parodies {
+		p.Series = append(p.Series, parody.Parody)
+	}
+	for _, c := range g.Characters {
+		p.Characters = append(p.Characters, c.Character)
+	}
+	for _, tag := range g.Tags {
+		p.Tags = append(p.Tags, tag.String())
+	}
+	return p
+}
+
+// StatusError is returned by http sinks when the server responded with an error status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.StatusCode)
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// postJSON posts v as JSON to url.
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Webhook posts Payload of events as JSON to URL.
+type Webhook struct {
+	URL string
+	// Client is used to send requests, http.DefaultClient if it is nil.
+	Client *http.Client
+}
+
+func (s *Webhook) Send(ctx context.Context, event Event) error {
+	return postJSON(ctx, s.Client, s.URL, NewPayload(event))
+}
+
+// Discord posts events as embeds to a Discord webhook URL.
+type Discord struct {
+	URL string
+	// Client is used to send requests, http.DefaultClient if it is nil.
+	Client *http.Client
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url"`
+	Description string         `json:"description,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+// discordMaxTitle and discordMaxField are the maximum lengths of embed title and field value allowed by Discord.
+const (
+	discordMaxTitle = 256
+	discordMaxField = 1024
+)
+
+// truncate cuts s to at most n characters, ending with "..." if it is cut.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
+
+func (s *Discord) Send(ctx context.Context, event Event) error {
+	p := NewPayload(event)
+	embed := discordEmbed{
+		Title:       truncate(p.Title, discordMaxTitle),
+		URL:         p.URL,
+		Description: fmt.Sprintf("%s, %d pages", p.Type, p.Pages),
+		Timestamp:   p.Published,
+		Footer:      &discordFooter{Text: p.Subscription},
+	}
+	field := func(name string, values []string, inline bool) {
+		value := strings.Join(values, ", ")
+		if value == "" {
+			return
+		}
+		embed.Fields = append(embed.Fields, discordField{Name: name, Value: truncate(value, discordMaxField), Inline: inline})
+	}
+	field("Artists", p.Artists, true)
+	field("Groups", p.Groups, true)
+	field("Series", p.Series, true)
+	if p.Language != "" {
+		field("Language", []string{p.Language}, true)
+	}
+	field("Tags", p.Tags, false)
+	return postJSON(ctx, s.Client, s.URL, discordMessage{Embeds: []discordEmbed{embed}})
+}
+
+// JSONLines writes Payload of events to a writer, one JSON object per line.
+type JSONLines struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{w: w}
+}
+
+// OpenJSONLines returns JSONLines appending to file of path, creating it if it does not exist.
+// The file is closed when the returned closer is closed.
+func OpenJSONLines(path string) (*JSONLines, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewJSONLines(f), f, nil
+}
+
+func (s *JSONLines) Send(_ context.Context, event Event) error {
+	content, err := json.Marshal(NewPayload(event))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// write the line at once so that lines of concurrent writers to the same file are not mixed
+	_, err = s.w.Write(append(content, '\n'))
+	return err
+}
+
+// Retry returns sink which retries sending to sink up to attempts times in total,
+// waiting backoff before the first retry and doubling it for each retry after.
+// StatusError of a status which is not Temporary, such as client errors of http sinks, is not retried,
+// while any other error, including transport errors like refused connections, is.
+func Retry(sink Sink, attempts int, backoff time.Duration) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		var err error
+		wait := backoff
+		for i := 0; i < max(attempts, 1); i++ {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+					return errors.Join(err, ctx.Err())
+				case <-time.After(wait):
+				}
+				wait *= 2
+			}
+			if err = sink.Send(ctx, event); err == nil {
+				return nil
+			}
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && !statusErr.Temporary() {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// Dedupe returns sink which sends each gallery to sink only once,
+// even if it is reported by several subscriptions.
+// Galleries are remembered in memory only after they are sent successfully,
+// so wrap each sink given to Multi rather than Multi itself, or a failing sink makes the others send again.
+// An event of a gallery being sent waits for the send, and is sent itself if the send failed.
+func Dedupe(sink Sink) Sink {
+	var mu sync.Mutex
+	sent := map[string]struct{}{}
+	sending := map[string]chan struct{}{}
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		id := event.Gallery.Id
+		for {
+			mu.Lock()
+			if _, ok := sent[id]; ok {
+				mu.Unlock()
+				return nil
+			}
+			done, ok := sending[id]
+			if !ok {
+				break
+			}
+			mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-done:
+			}
+		}
+		// reserve the id so that concurrent events of the same gallery wait for this send
+		done := make(chan struct{})
+		sending[id] = done
+		mu.Unlock()
+
+		err := sink.Send(ctx, event)
+		mu.Lock()
+		delete(sending, id)
+		if err == nil {
+			sent[id] = struct{}{}
+		}
+		mu.Unlock()
+		close(done)
+		return err
+	})
+}
+
+// Multi returns sink which sends events to every sink, joining their errors.
+func Multi(sinks ...Sink) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		var errs []error
+		for _, sink := range sinks {
+			if err := sink.Send(ctx, event); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
@@ -0,0 +1,205 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/EINNN7/hitomi"
+)
+
+func testEvent(t *testing.T, id string) Event {
+	g := new(hitomi.Gallery)
+	script := `{"Id": "` + id + `", "Title": "title", "Type": "manga", "Language": "korean",
+		"GalleryUrl": "/manga/title-` + id + `.html", "Published": "2024-01-02T03:04:05Z",
+		"Artists": [{"Artist": "alice"}], "Tags": [{"Namespace": "female", "Name": "big breasts"}],
+		"Files": [{"Hash": "a"}, {"Hash": "b"}]}`
+	if err := json.Unmarshal([]byte(script), g); err != nil {
+		t.Fatal(err)
+	}
+	return Event{Subscription: Artist("alice"), Gallery: g}
+}
+
+// recorder is a server recording request bodies, responding with statuses in order.
+type recorder struct {
+	mu       sync.Mutex
+	bodies   []string
+	statuses []int
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, string(body))
+	if len(r.statuses) > 0 {
+		w.WriteHeader(r.statuses[0])
+		r.statuses = r.statuses[1:]
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	sink := &Webhook{URL: server.URL}
+	if err := sink.Send(context.Background(), testEvent(t, "1")); err != nil {
+		t.Fatal(err)
+	}
+	var p Payload
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "1" || p.Subscription != "artist:alice" || p.URL != "https://hitomi.la/manga/title-1.html" ||
+		p.Pages != 2 || p.Published != "2024-01-02T03:04:05Z" || p.Tags[0] != "female:big_breasts" {
+		t.Errorf("payload = %+v", p)
+	}
+
+	rec.statuses = []int{http.StatusBadRequest}
+	var statusErr *StatusError
+	if err := sink.Send(context.Background(), testEvent(t, "1")); !errors.As(err, &statusErr) || statusErr.StatusCode != 400 {
+		t.Errorf("Send = %v", err)
+	}
+}
+
+func TestDiscord(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	sink := &Discord{URL: server.URL}
+	if err := sink.Send(context.Background(), testEvent(t, "1")); err != nil {
+		t.Fatal(err)
+	}
+	var message discordMessage
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &message); err != nil {
+		t.Fatal(err)
+	}
+	embed := message.Embeds[0]
+	if embed.Title != "title" || embed.Description != "manga, 2 pages" || embed.Footer.Text != "artist:alice" || len(embed.Fields) != 3 {
+		t.Errorf("embed = %+v", embed)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	long := strings.Repeat("가", 300)
+	got := truncate(long, discordMaxTitle)
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != discordMaxTitle || !strings.HasSuffix(got, "...") {
+		t.Errorf("truncate = %d runes, valid %v", utf8.RuneCountInString(got), utf8.ValidString(got))
+	}
+	if got := truncate("title", discordMaxTitle); got != "title" {
+		t.Errorf("truncate(short) = %q", got)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLines(&buf)
+	for _, id := range []string{"1", "2"} {
+		if err := sink.Send(context.Background(), testEvent(t, id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"id":"2"`) {
+		t.Errorf("lines = %q", lines)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	rec := &recorder{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	sink := Retry(&Webhook{URL: server.URL}, 3, time.Millisecond)
+	if err := sink.Send(context.Background(), testEvent(t, "1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.bodies) != 3 {
+		t.Errorf("requests = %d", len(rec.bodies))
+	}
+
+	// client errors are not retried
+	rec.bodies = nil
+	rec.statuses = []int{http.StatusNotFound}
+	if err := sink.Send(context.Background(), testEvent(t, "1")); err == nil || len(rec.bodies) != 1 {
+		t.Errorf("Send = %v after %d requests", err, len(rec.bodies))
+	}
+	// transport errors are retried, even though they are not Temporary
+	attempts := 0
+	sink = Retry(SinkFunc(func(ctx context.Context, event Event) error {
+		attempts++
+		return &url.Error{Op: "Post", URL: "http://127.0.0.1:1", Err: errors.New("connection refused")}
+	}), 3, time.Millisecond)
+	if err := sink.Send(context.Background(), testEvent(t, "1")); err == nil || attempts != 3 {
+		t.Errorf("Send = %v after %d attempts", err, attempts)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	var sent []string
+	fail := true
+	sink := Dedupe(SinkFunc(func(ctx context.Context, event Event) error {
+		if fail {
+			fail = false
+			return errors.New("failed")
+		}
+		sent = append(sent, event.Gallery.Id)
+		return nil
+	}))
+	for _, id := range []string{"1", "1", "2", "1", "2"} {
+		_ = sink.Send(context.Background(), testEvent(t, id))
+	}
+	// first send of 1 failed, so it is sent again
+	if strings.Join(sent, ",") != "1,2" {
+		t.Errorf("sent = %v", sent)
+	}
+}
+
+func TestDedupe_Concurrent(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var mu sync.Mutex
+	var calls int
+	sink := Dedupe(SinkFunc(func(ctx context.Context, event Event) error {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+			return errors.New("failed")
+		}
+		return nil
+	}))
+
+	event := testEvent(t, "1")
+	errs := make(chan error)
+	go func() { errs <- sink.Send(context.Background(), event) }()
+	<-started
+	go func() { errs <- sink.Send(context.Background(), event) }()
+	// let the duplicate find the send in flight
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	// the duplicate waits for the failed send and sends the event itself instead of dropping it
+	var failed int
+	for range 2 {
+		if err := <-errs; err != nil {
+			failed++
+		}
+	}
+	if failed != 1 || calls != 2 {
+		t.Errorf("failed = %d, calls = %d", failed, calls)
+	}
+}
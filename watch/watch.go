@@ -0,0 +1,407 @@
+// Package watch detects newly published galleries of subscribed artists, groups, series and queries.
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+)
+
+// Options are options for Watcher.
+type Options struct {
+	// Interval is the time between checks of Run.
+	Interval time.Duration
+
+	// StatePath is the file where seen galleries are saved, if it is set.
+	// Without it, every subscription starts from scratch when the program restarts.
+	StatePath string
+
+	// EmitExisting is an option to emit galleries found on the first check of a subscription.
+	// Otherwise, the first check only records them as seen.
+	EmitExisting bool
+
+	// Batch is used to fetch metadata of new galleries.
+	Batch *hitomi.BatchOptions
+
+	// Filter excludes galleries from events and downloads, if it is set.
+	// Excluded galleries are marked as seen without being reported.
+	Filter *hitomi.Filter
+
+	// Download is called by Run for each new gallery, one at a time in the background, if it is set.
+	// A gallery matched by several subscriptions is downloaded once.
+	Download func(ctx context.Context, g *hitomi.Gallery) error
+
+	// Error is called by Run for errors of checks and downloads, if it is set.
+	Error func(err error)
+}
+
+func (o *Options) WithInterval(d time.Duration) *Options {
+	o.Interval = d
+	return o
+}
+
+func (o *Options) WithStatePath(path string) *Options {
+	o.StatePath = path
+	return o
+}
+
+func (o *Options) WithEmitExisting(b bool) *Options {
+	o.EmitExisting = b
+	return o
+}
+
+func (o *Options) WithBatch(opts *hitomi.BatchOptions) *Options {
+	o.Batch = opts
+	return o
+}
+
+func (o *Options) WithFilter(f *hitomi.Filter) *Options {
+	o.Filter = f
+	return o
+}
+
+func (o *Options) WithDownload(f func(ctx context.Context, g *hitomi.Gallery) error) *Options {
+	o.Download = f
+	return o
+}
+
+func (o *Options) WithError(f func(err error)) *Options {
+	o.Error = f
+	return o
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Interval:     30 * time.Minute,
+		StatePath:    "",
+		EmitExisting: false,
+		Batch:        hitomi.DefaultBatchOptions().WithOrdered(true),
+		Filter:       nil,
+		Download:     nil,
+		Error:        nil,
+	}
+}
+
+func (o *Options) error(err error) {
+	if o.Error != nil {
+		o.Error(err)
+	}
+}
+
+// Subscription is a query whose new galleries are watched.
+type Subscription struct {
+	// Name identifies the subscription in the saved state.
+	Name string
+	// Query is searched by Search.Query, see hitomi.ParseQuery for the syntax.
+	Query string
+}
+
+// Artist returns subscription of galleries by artist.
+func Artist(name string) Subscription {
+	return tagSubscription(hitomi.NamespaceArtist, name)
+}
+
+// Group returns subscription of galleries by group.
+func Group(name string) Subscription {
+	return tagSubscription(hitomi.NamespaceGroup, name)
+}
+
+// Series returns subscription of galleries of series.
+func Series(name string) Subscription {
+	return tagSubscription(hitomi.NamespaceSeries, name)
+}
+
+// Query returns subscription of galleries matching query.
+func Query(query string) Subscription {
+	return Subscription{Name: query, Query: query}
+}
+
+func tagSubscription(namespace, name string) Subscription {
+	tag := hitomi.Tag{Namespace: namespace, Name: strings.ToLower(strings.TrimSpace(name))}
+	return Subscription{Name: tag.String(), Query: tag.String()}
+}
+
+// Event reports a new gallery of subscription.
+type Event struct {
+	Subscription Subscription
+	Gallery      *hitomi.Gallery
+}
+
+// Watcher periodically searches subscriptions and reports galleries not seen before.
+// It is safe for concurrent use.
+type Watcher struct {
+	client *hitomi.Client
+	search *hitomi.Search
+	opts   *Options
+
+	// checkMu serializes checks, so that a gallery is never reported twice.
+	checkMu sync.Mutex
+
+	mu            sync.Mutex
+	subscriptions []Subscription
+	seen          map[string]map[int]struct{}
+}
+
+// New returns a watcher using client and search made of options, loading seen galleries from opts.StatePath if it exists.
+// The search is private to the watcher, since its caches are dropped on every check.
+func New(options *hitomi.Options, opts *Options) (*Watcher, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	w := &Watcher{
+		client: hitomi.NewClient(options),
+		search: hitomi.NewSearch(options),
+		opts:   opts,
+		seen:   map[string]map[int]struct{}{},
+	}
+	if opts.StatePath == "" {
+		return w, nil
+	}
+	content, err := os.ReadFile(opts.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state map[string][]int
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("invalid state %s: %w", opts.StatePath, err)
+	}
+	for name, ids := range state {
+		w.seen[name] = idSet(ids)
+	}
+	return w, nil
+}
+
+// Subscribe adds subscription, replacing existing one of the same name.
+func (w *Watcher) Subscribe(sub Subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscriptions = slices.DeleteFunc(w.subscriptions, func(s Subscription) bool { return s.Name == sub.Name })
+	w.subscriptions = append(w.subscriptions, sub)
+}
+
+// Unsubscribe removes subscription of name and forgets its seen galleries.
+func (w *Watcher) Unsubscribe(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscriptions = slices.DeleteFunc(w.subscriptions, func(s Subscription) bool { return s.Name == name })
+	delete(w.seen, name)
+}
+
+// Subscriptions returns subscriptions in the order they were added.
+func (w *Watcher) Subscriptions() []Subscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.subscriptions)
+}
+
+// Check searches every subscription once and returns events of new galleries, newest first per subscription.
+// Galleries whose metadata failed to fetch are not marked as seen, so they are retried on the next check.
+// Errors of subscriptions are joined in the returned error, along with events of the others.
+func (w *Watcher) Check(ctx context.Context) ([]Event, error) {
+	w.checkMu.Lock()
+	defer w.checkMu.Unlock()
+
+	// nozomi files change without index versions changing, so cached results are stale
+	w.search.Refresh()
+	var events []Event
+	var errs []error
+	for _, sub := range w.Subscriptions() {
+		found, err := w.check(ctx, sub)
+		events = append(events, found...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.Name, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := w.save(); err != nil {
+		errs = append(errs, err)
+	}
+	return events, errors.Join(errs...)
+}
+
+func (w *Watcher) check(ctx context.Context, sub Subscription) ([]Event, error) {
+	result, err := w.search.Query(w.opts.Filter.Query(sub.Query))
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	seen, ok := w.seen[sub.Name]
+	if !ok && !w.opts.EmitExisting {
+		w.seen[sub.Name] = idSet(result.IDs)
+		w.mu.Unlock()
+		return nil, nil
+	}
+	if !ok {
+		seen = map[int]struct{}{}
+		w.seen[sub.Name] = seen
+	}
+	var fresh []int
+	for _, id := range result.IDs {
+		if _, ok := seen[id]; !ok {
+			fresh = append(fresh, id)
+		}
+	}
+	w.mu.Unlock()
+
+	var events []Event
+	var errs []error
+	for r := range w.client.Galleries(ctx, fresh, w.opts.Batch) {
+		if r.Err != nil && !errors.Is(r.Err, hitomi.ErrExcluded) {
+			errs = append(errs, r.Err)
+			continue
+		}
+		w.mu.Lock()
+		seen[r.Id] = struct{}{}
+		w.mu.Unlock()
+		if r.Err == nil && w.opts.Filter.Allow(r.Gallery) {
+			events = append(events, Event{Subscription: sub, Gallery: r.Gallery})
+		}
+	}
+	return events, errors.Join(errs...)
+}
+
+// save writes seen galleries to opts.StatePath.
+func (w *Watcher) save() error {
+	if w.opts.StatePath == "" {
+		return nil
+	}
+	w.mu.Lock()
+	state := make(map[string][]int, len(w.seen))
+	for name, seen := range w.seen {
+		ids := make([]int, 0, len(seen))
+		for id := range seen {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		state[name] = ids
+	}
+	w.mu.Unlock()
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// write to temporary file first so that a crash never leaves a broken state
+	f, err := os.CreateTemp(filepath.Dir(w.opts.StatePath), ".state-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), w.opts.StatePath)
+}
+
+// Run checks subscriptions every opts.Interval until ctx is done, calling handler for each event.
+// handler may be nil if only opts.Download is used.
+// It returns ctx.Err() after waiting for queued downloads to stop.
+func (w *Watcher) Run(ctx context.Context, handler func(Event)) error {
+	var queue chan *hitomi.Gallery
+	var wg sync.WaitGroup
+	// queued holds galleries waiting for or being downloaded, so that they are not queued again meanwhile
+	var queuedMu sync.Mutex
+	queued := map[string]struct{}{}
+	if w.opts.Download != nil {
+		queue = make(chan *hitomi.Gallery, 64)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range queue {
+				if err := w.opts.Download(ctx, g); err != nil && ctx.Err() == nil {
+					w.opts.error(fmt.Errorf("download %s: %w", g.Id, err))
+				}
+				queuedMu.Lock()
+				delete(queued, g.Id)
+				queuedMu.Unlock()
+			}
+		}()
+		defer func() {
+			close(queue)
+			wg.Wait()
+		}()
+	}
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		events, err := w.Check(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.opts.error(err)
+		}
+		// galleries of several subscriptions are queued once per check, even if the first download finished already
+		checked := map[string]struct{}{}
+		for _, event := range events {
+			if handler != nil {
+				handler(event)
+			}
+			if _, ok := checked[event.Gallery.Id]; queue == nil || ok {
+				continue
+			}
+			checked[event.Gallery.Id] = struct{}{}
+			queuedMu.Lock()
+			_, ok := queued[event.Gallery.Id]
+			queued[event.Gallery.Id] = struct{}{}
+			queuedMu.Unlock()
+			if ok {
+				continue
+			}
+			select {
+			case queue <- event.Gallery:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Events runs Run in a new goroutine and returns a channel of its events,
+// which is closed when ctx is done.
+func (w *Watcher) Events(ctx context.Context) <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		_ = w.Run(ctx, func(event Event) {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return ch
+}
+
+func idSet(ids []int) map[int]struct{} {
+	set := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
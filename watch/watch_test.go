@@ -0,0 +1,149 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EINNN7/hitomi"
+	"github.com/EINNN7/hitomi/internal/stub"
+)
+
+// setNozomi sets nozomi file of path listing ids, and gallery scripts of ids titled "gallery <id>".
+func setNozomi(h *stub.Hitomi, path string, ids ...int) {
+	h.SetNozomi(path, ids...)
+	for _, id := range ids {
+		h.SetGallery(id, fmt.Sprintf(`{"id": "%d", "title": "gallery %d"}`, id, id))
+	}
+}
+
+func newTestWatcher(t *testing.T, s *stub.Hitomi, opts *Options) *Watcher {
+	options := hitomi.DefaultOptions().WithClient(s.Client())
+	w, err := New(options, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func galleryIDs(events []Event) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.Subscription.Name+"/"+event.Gallery.Id)
+	}
+	return ids
+}
+
+func TestWatcher_Check(t *testing.T) {
+	s := stub.New()
+	setNozomi(s, "artist/some one-all.nozomi", 3, 2, 1)
+	setNozomi(s, "index-korean.nozomi", 5, 2)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	opts := DefaultOptions().WithStatePath(statePath)
+
+	w := newTestWatcher(t, s, opts)
+	w.Subscribe(Artist("Some One"))
+	w.Subscribe(Query("language:korean"))
+	events, err := w.Check(context.Background())
+	if err != nil || len(events) != 0 {
+		t.Fatalf("first Check = %v, %v", galleryIDs(events), err)
+	}
+
+	setNozomi(s, "artist/some one-all.nozomi", 5, 4, 3, 2, 1)
+	setNozomi(s, "index-korean.nozomi", 6, 5, 2)
+	s.SetStatus("/galleries/6.js", 500)
+	events, err = w.Check(context.Background())
+	if err == nil {
+		t.Error("Check did not report failed gallery")
+	}
+	if got := fmt.Sprint(galleryIDs(events)); got != "[artist:some_one/5 artist:some_one/4]" {
+		t.Errorf("events = %s", got)
+	}
+
+	// failed gallery is retried, and state is restored from file
+	s.SetStatus("/galleries/6.js", 0)
+	w = newTestWatcher(t, s, opts)
+	w.Subscribe(Artist("some one"))
+	w.Subscribe(Query("language:korean"))
+	events, err = w.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(galleryIDs(events)); got != "[language:korean/6]" {
+		t.Errorf("events after reopen = %s", got)
+	}
+}
+
+func TestWatcher_Run(t *testing.T) {
+	s := stub.New()
+	setNozomi(s, "group/team-all.nozomi", 2, 1)
+	setNozomi(s, "series/original-all.nozomi", 2)
+
+	var mu sync.Mutex
+	var downloaded []string
+	done := make(chan struct{})
+	opts := DefaultOptions().WithEmitExisting(true).WithInterval(time.Hour).
+		WithDownload(func(ctx context.Context, g *hitomi.Gallery) error {
+			mu.Lock()
+			defer mu.Unlock()
+			downloaded = append(downloaded, g.Id)
+			if len(downloaded) == 2 {
+				close(done)
+			}
+			return nil
+		})
+	w := newTestWatcher(t, s, opts)
+	w.Subscribe(Group("team"))
+	w.Subscribe(Series("original"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var events int
+	go func() {
+		<-done
+		cancel()
+	}()
+	if err := w.Run(ctx, func(Event) { events++ }); err != context.Canceled {
+		t.Errorf("Run = %v", err)
+	}
+	if events != 3 {
+		t.Errorf("events = %d", events)
+	}
+	if fmt.Sprint(downloaded) != "[2 1]" {
+		t.Errorf("downloaded = %v", downloaded)
+	}
+}
+
+func TestWatcher_Run_Requeue(t *testing.T) {
+	s := stub.New()
+	setNozomi(s, "group/team-all.nozomi", 1)
+	setNozomi(s, "series/original-all.nozomi", 1)
+
+	downloads := make(chan string)
+	opts := DefaultOptions().WithEmitExisting(true).WithInterval(10 * time.Millisecond).
+		WithDownload(func(ctx context.Context, g *hitomi.Gallery) error {
+			select {
+			case downloads <- g.Id:
+			case <-ctx.Done():
+			}
+			return nil
+		})
+	w := newTestWatcher(t, s, opts)
+	w.Subscribe(Group("team"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { errs <- w.Run(ctx, nil) }()
+	<-downloads
+	// a gallery is forgotten once downloaded, so a later subscription reporting it queues it again
+	w.Subscribe(Series("original"))
+	select {
+	case <-downloads:
+	case <-time.After(time.Second):
+		t.Error("gallery was not queued again")
+	}
+	cancel()
+	<-errs
+}